@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportMyData bundles everything we store about the caller as a JSON download
+func ExportMyData() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user: " + err.Error()})
+			}
+			return
+		}
+
+		var links []models.Member
+		linkCursor, err := linkedMemberCollection.Find(ctx, bson.M{"uid": uid})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching member links: " + err.Error()})
+			return
+		}
+		if err = linkCursor.All(ctx, &links); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding member links: " + err.Error()})
+			return
+		}
+
+		tripIDs := make([]string, 0)
+		for _, link := range links {
+			if link.Trip_ID != nil {
+				tripIDs = append(tripIDs, *link.Trip_ID)
+			}
+		}
+
+		trips := make([]models.Trip, 0)
+		tripCursor, err := tripCollection.Find(ctx, bson.M{"$or": bson.A{
+			bson.M{"creator_id": uid},
+			bson.M{"trip_id": bson.M{"$in": tripIDs}},
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching trips: " + err.Error()})
+			return
+		}
+		if err = tripCursor.All(ctx, &trips); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding trips: " + err.Error()})
+			return
+		}
+
+		// Only the transactions the user took part in, matched by their member in each trip
+		transactions := make([]models.Transaction, 0)
+		for _, link := range links {
+			if link.Trip_ID == nil || link.Name == nil {
+				continue
+			}
+			involved := bson.A{
+				bson.M{"payername": *link.Name},
+				bson.M{"recivername": *link.Name},
+			}
+			if link.Member_ID != nil {
+				involved = bson.A{
+					bson.M{"payer_id": *link.Member_ID},
+					bson.M{"reciver_id": *link.Member_ID},
+				}
+			}
+			var tripTransactions []models.Transaction
+			txnCursor, err := transactionCollection.Find(ctx, bson.M{
+				"trip_id": *link.Trip_ID,
+				"$or":     involved,
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+				return
+			}
+			if err = txnCursor.All(ctx, &tripTransactions); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding transactions: " + err.Error()})
+				return
+			}
+			transactions = append(transactions, tripTransactions...)
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=\"split-express-export-"+uid+".json\"")
+		c.JSON(http.StatusOK, gin.H{
+			"exported_at":  time.Now(),
+			"profile":      user.Self(),
+			"trips":        trips,
+			"member_links": links,
+			"transactions": transactions,
+		})
+	}
+}
+
+// RequestAccountDeletion schedules the caller's account for anonymization after the grace period
+func RequestAccountDeletion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		now := time.Now()
+		scheduledAt := now.Add(helpers.AccountDeletionGracePeriod())
+
+		result, err := userCollection.UpdateOne(ctx,
+			bson.M{"user_id": uid, "is_deleted": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{
+				"deletion_requested_at": now,
+				"deletion_scheduled_at": scheduledAt,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":               "Account deletion scheduled",
+			"deletion_scheduled_at": scheduledAt,
+		})
+	}
+}
+
+// CancelAccountDeletion withdraws a pending deletion request during the grace period
+func CancelAccountDeletion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		result, err := userCollection.UpdateOne(ctx,
+			bson.M{
+				"user_id":               uid,
+				"is_deleted":            bson.M{"$ne": true},
+				"deletion_scheduled_at": bson.M{"$gt": time.Now()},
+			},
+			bson.M{"$unset": bson.M{
+				"deletion_requested_at": "",
+				"deletion_scheduled_at": "",
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No pending account deletion to cancel"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+	}
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var unsafeAttachmentName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// loadTransactionForMember finds a live transaction of a trip the caller
+// belongs to, writing the error response itself
+func loadTransactionForMember(ctx context.Context, c *gin.Context, tripID, transactionID string) (models.Trip, *models.TripMember, models.Transaction, bool) {
+	var txn models.Transaction
+	trip, caller, ok := loadTripForMember(ctx, c, tripID)
+	if !ok {
+		return trip, caller, txn, false
+	}
+
+	txnID, err := primitive.ObjectIDFromHex(transactionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID format"})
+		return trip, caller, txn, false
+	}
+	err = transactionCollection.FindOne(ctx, bson.M{
+		"_id":        txnID,
+		"trip_id":    tripID,
+		"is_deleted": bson.M{"$ne": true},
+	}).Decode(&txn)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return trip, caller, txn, false
+	}
+	return trip, caller, txn, true
+}
+
+// UploadAttachment attaches a receipt image or PDF to a transaction.
+// Expects a multipart form with trip_id, transaction_id and file.
+func UploadAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		maxBytes := helpers.MaxAttachmentBytes()
+		// Leave room for the other form fields
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64*1024)
+
+		tripID := c.PostForm("trip_id")
+		transactionID := c.PostForm("transaction_id")
+		if tripID == "" || transactionID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "trip_id and transaction_id are required"})
+			return
+		}
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required (max " + strconv.FormatInt(maxBytes, 10) + " bytes): " + err.Error()})
+			return
+		}
+		if fileHeader.Size > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachment is larger than " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+
+		trip, _, txn, ok := loadTransactionForMember(ctx, c, tripID, transactionID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if txn.Attachments != nil && len(*txn.Attachments) >= helpers.MaxAttachmentsPerTransaction {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A transaction can have at most " + strconv.Itoa(helpers.MaxAttachmentsPerTransaction) + " attachments"})
+			return
+		}
+		if _, ok := requireTransactionVersion(c, txn); !ok {
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read file: " + err.Error()})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read file: " + err.Error()})
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachment is larger than " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+
+		contentType, allowed := helpers.SniffAttachmentType(data)
+		if !allowed {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported file type: " + contentType})
+			return
+		}
+
+		attachment, err := helpers.SaveAttachment(ctx, txn, filepath.Base(fileHeader.Filename), contentType, data, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":    "Attachment uploaded successfully",
+			"attachment": attachment,
+		})
+	}
+}
+
+// DownloadAttachment streams an attachment back to a trip member
+func DownloadAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		_, _, txn, ok := loadTransactionForMember(ctx, c, c.Query("trip_id"), c.Query("transaction_id"))
+		if !ok {
+			return
+		}
+		attachment := helpers.FindAttachment(txn, c.Query("attachment_id"))
+		if attachment == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		if attachment.Key == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment file is missing"})
+			return
+		}
+		contentType, filename := "application/octet-stream", "attachment"
+		if attachment.Content_Type != nil {
+			contentType = *attachment.Content_Type
+		}
+		if attachment.Filename != nil {
+			filename = *attachment.Filename
+		}
+
+		store, err := helpers.Blobs()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reader, err := store.Get(ctx, *attachment.Key)
+		if err == helpers.ErrBlobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment file is missing"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment: " + err.Error()})
+			return
+		}
+		defer reader.Close()
+
+		c.DataFromReader(http.StatusOK, attachment.Size, contentType, reader, map[string]string{
+			"Content-Disposition": "inline; filename=\"" + unsafeAttachmentName.ReplaceAllString(filename, "_") + "\"",
+		})
+	}
+}
+
+// DeleteAttachment removes an attachment. The uploader, the payer and trip
+// admins may delete it.
+func DeleteAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID        string `json:"trip_id" binding:"required"`
+			TransactionID string `json:"transaction_id" binding:"required"`
+			AttachmentID  string `json:"attachment_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, caller, txn, ok := loadTransactionForMember(ctx, c, request.TripID, request.TransactionID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		attachment := helpers.FindAttachment(txn, request.AttachmentID)
+		if attachment == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+
+		isUploader := attachment.Uploaded_By != nil && *attachment.Uploaded_By == uid
+		isPayer := caller != nil && txn.Payer_ID != nil && *txn.Payer_ID == *caller.Member_ID
+		if !isUploader && !isPayer && !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't delete this attachment"})
+			return
+		}
+		if _, ok := requireTransactionVersion(c, txn); !ok {
+			return
+		}
+
+		if err := helpers.DeleteAttachment(ctx, txn, *attachment); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+	}
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetTripCategories lists the expense categories a trip can use
+func GetTripCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"default_categories": helpers.DefaultCategories,
+			"categories":         helpers.TripCategories(trip),
+		})
+	}
+}
+
+// AddTripCategory adds a custom expense category to a trip
+func AddTripCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+			Name   string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		category := helpers.NormalizeCategory(request.Name)
+		if category == "" || category == helpers.Uncategorized || category == "total" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category name"})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if helpers.ValidCategory(trip, category) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Category already exists"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		result, err := tripCollection.UpdateOne(ctx,
+			helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected),
+			helpers.BumpVersion(bson.M{"$addToSet": bson.M{"categories": category}}),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add category: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Category added successfully",
+			"category": category,
+		})
+	}
+}
+
+// SetTripBudget replaces a trip's total and per-category budgets
+func SetTripBudget() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID          string             `json:"trip_id" binding:"required"`
+			TotalBudget     *float64           `json:"total_budget"`
+			CategoryBudgets map[string]float64 `json:"category_budgets"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can set budgets"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		if request.TotalBudget != nil && *request.TotalBudget <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Budgets must be positive"})
+			return
+		}
+		categoryBudgets := make(map[string]float64, len(request.CategoryBudgets))
+		for name, budget := range request.CategoryBudgets {
+			category := helpers.NormalizeCategory(name)
+			if !helpers.ValidCategory(trip, category) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category: " + name})
+				return
+			}
+			if budget <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Budgets must be positive"})
+				return
+			}
+			categoryBudgets[category] = budget
+		}
+
+		set := bson.M{}
+		unset := bson.M{}
+		if request.TotalBudget != nil {
+			set["total_budget"] = *request.TotalBudget
+		} else {
+			unset["total_budget"] = ""
+		}
+		if len(categoryBudgets) > 0 {
+			set["category_budgets"] = categoryBudgets
+		} else {
+			unset["category_budgets"] = ""
+		}
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+
+		result, err := tripCollection.UpdateOne(ctx, helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected), helpers.BumpVersion(update))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set budget: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "Budget updated successfully",
+			"total_budget":     request.TotalBudget,
+			"category_budgets": categoryBudgets,
+		})
+	}
+}
+
+// GetBudgetReport reports a trip's spending against its budgets
+func GetBudgetReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+
+		transactions, err := helpers.TripTransactions(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+			return
+		}
+		spend, total := helpers.CategorySpend(transactions)
+
+		line := func(category string, spent float64, budget *float64) gin.H {
+			item := gin.H{"category": category, "spent": spent}
+			if budget != nil {
+				item["budget"] = *budget
+				item["remaining"] = *budget - spent
+				item["exceeded"] = spent > *budget
+			}
+			return item
+		}
+
+		categories := make([]gin.H, 0)
+		for _, category := range append(helpers.TripCategories(trip), helpers.Uncategorized) {
+			var budget *float64
+			if b, ok := trip.Category_Budgets[category]; ok {
+				budget = &b
+			}
+			if budget == nil && spend[category] == 0 {
+				continue
+			}
+			categories = append(categories, line(category, spend[category], budget))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"trip_id":    request.TripID,
+			"total":      line("total", total, trip.Total_Budget),
+			"categories": categories,
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// ExportTrip downloads a trip's ledger as CSV or JSON, or its settlement
+// statement as a PDF
+func ExportTrip() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+			Format string `json:"format"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		if request.Format == "" {
+			request.Format = "csv"
+		}
+		if request.Format != "csv" && request.Format != "json" && request.Format != "pdf" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, json or pdf"})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+
+		transactions, err := helpers.TripTransactions(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+			return
+		}
+		ledger := helpers.TripLedger(trip, transactions)
+
+		filename := "trip"
+		if trip.Name != nil {
+			if name := unsafeFilename.ReplaceAllString(*trip.Name, "_"); name != "" {
+				filename = name
+			}
+		}
+		c.Header("Content-Disposition", "attachment; filename=\""+filename+"."+request.Format+"\"")
+
+		switch request.Format {
+		case "csv":
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Status(http.StatusOK)
+			if err := helpers.WriteLedgerCSV(c.Writer, ledger); err != nil {
+				// Headers are gone already, all we can do is stop
+				c.Error(err)
+			}
+		case "json":
+			c.JSON(http.StatusOK, gin.H{
+				"trip_id":      request.TripID,
+				"trip_name":    trip.Name,
+				"currency":     helpers.TripCurrency(trip),
+				"exported_at":  time.Now(),
+				"members":      helpers.TripStatement(trip, transactions),
+				"transactions": ledger,
+				"settlements":  helpers.CalculateSettlements(transactions),
+			})
+		case "pdf":
+			pdf := helpers.TripStatementPDF(trip, ledger, helpers.TripStatement(trip, transactions), helpers.CalculateSettlements(transactions))
+			c.Data(http.StatusOK, "application/pdf", pdf)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetFriends lists the caller's friends with their net balance across every shared trip.
+// A positive net_balance means the friend owes the caller.
+func GetFriends() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		friendships, err := helpers.ListFriendships(ctx, uid, "ACCEPTED")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching friends: " + err.Error()})
+			return
+		}
+		friendUIDs := make([]string, 0, len(friendships))
+		for _, friendship := range friendships {
+			friendUIDs = append(friendUIDs, helpers.OtherUser(friendship, uid))
+		}
+
+		profiles, err := helpers.PublicUsers(ctx, friendUIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sharedTrips, err := helpers.SharedTripCounts(ctx, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		positions, err := helpers.UserTripPositions(ctx, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error calculating balances: " + err.Error()})
+			return
+		}
+		// Trips keep their own currency, so balances are summed per currency
+		balances := helpers.BalancesByUser(positions)
+
+		friends := make([]gin.H, 0, len(friendships))
+		for _, friendship := range friendships {
+			friendUID := helpers.OtherUser(friendship, uid)
+			profile, ok := profiles[friendUID]
+			if !ok {
+				continue // deleted account
+			}
+			friends = append(friends, gin.H{
+				"user":          profile,
+				"friends_since": friendship.Responded_At,
+				"shared_trips":  sharedTrips[friendUID],
+				"net_balance":   currencyTotals(balances[friendUID]),
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": len(friends),
+			"friends":     friends,
+		})
+	}
+}
+
+// currencyTotals is never null in a response, a friend with no balances gets {}
+func currencyTotals(totals helpers.CurrencyTotals) helpers.CurrencyTotals {
+	if totals == nil {
+		return helpers.CurrencyTotals{}
+	}
+	return totals
+}
+
+// GetFriendSuggestions suggests people the caller travelled with or has in
+// their contacts. The request body may carry the same contacts payload as
+// /trip/contactinfo.
+func GetFriendSuggestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		var req models.GetContact
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+		if limit := helpers.MaxContactsPerRequest(); len(req.Contacts) > limit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Too many contacts"})
+			return
+		}
+
+		// Step 1: people already connected are not suggested again
+		excluded := map[string]bool{uid: true}
+		for _, status := range []string{"ACCEPTED", "PENDING"} {
+			friendships, err := helpers.ListFriendships(ctx, uid, status)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching friends: " + err.Error()})
+				return
+			}
+			for _, friendship := range friendships {
+				excluded[helpers.OtherUser(friendship, uid)] = true
+			}
+		}
+
+		// Step 2: co-travelers and contact matches
+		sharedTrips, err := helpers.SharedTripCounts(ctx, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		contactNames := make(map[string]*string)
+		if len(req.Contacts) > 0 {
+			matches, err := helpers.GetContactInfoHelper(req.Contacts, req.Region, req.Hashed)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process contacts: " + err.Error()})
+				return
+			}
+			for _, match := range matches {
+				if match.Uid != nil {
+					contactNames[*match.Uid] = match.Name
+				}
+			}
+		}
+
+		candidates := make([]string, 0)
+		for candidate := range sharedTrips {
+			if !excluded[candidate] {
+				candidates = append(candidates, candidate)
+			}
+		}
+		for candidate := range contactNames {
+			if _, counted := sharedTrips[candidate]; !counted && !excluded[candidate] {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		// Step 3: the most frequent co-travelers first, contacts break ties
+		profiles, err := helpers.PublicUsers(ctx, candidates)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if sharedTrips[a] != sharedTrips[b] {
+				return sharedTrips[a] > sharedTrips[b]
+			}
+			_, aContact := contactNames[a]
+			_, bContact := contactNames[b]
+			if aContact != bContact {
+				return aContact
+			}
+			return a < b
+		})
+
+		suggestions := make([]gin.H, 0, len(candidates))
+		for _, candidate := range candidates {
+			profile, ok := profiles[candidate]
+			if !ok {
+				continue
+			}
+			contactName, inContacts := contactNames[candidate]
+			suggestions = append(suggestions, gin.H{
+				"user":         profile,
+				"shared_trips": sharedTrips[candidate],
+				"in_contacts":  inContacts,
+				"contact_name": contactName,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": len(suggestions),
+			"suggestions": suggestions,
+		})
+	}
+}
+
+// SendFriendRequest asks another user to become the caller's friend
+func SendFriendRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Uid string `json:"uid" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		if request.Uid == uid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't send a friend request to yourself"})
+			return
+		}
+
+		profiles, err := helpers.PublicUsers(ctx, []string{request.Uid})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if _, ok := profiles[request.Uid]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		friendship, err := helpers.SendFriendRequest(ctx, uid, request.Uid)
+		if err != nil {
+			if err == helpers.ErrAlreadyFriends || err == helpers.ErrFriendRequestPending {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		message := "Friend request sent successfully"
+		if *friendship.Requester_ID != uid {
+			message = "Friend request accepted"
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":    message,
+			"request_id": friendship.ID.Hex(),
+		})
+	}
+}
+
+// GetFriendRequests lists the caller's pending incoming and outgoing friend requests
+func GetFriendRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		requests, err := helpers.ListFriendships(ctx, uid, "PENDING")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching friend requests: " + err.Error()})
+			return
+		}
+		others := make([]string, 0, len(requests))
+		for _, request := range requests {
+			others = append(others, helpers.OtherUser(request, uid))
+		}
+		profiles, err := helpers.PublicUsers(ctx, others)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		incoming := make([]gin.H, 0)
+		outgoing := make([]gin.H, 0)
+		for _, request := range requests {
+			profile, ok := profiles[helpers.OtherUser(request, uid)]
+			if !ok {
+				continue
+			}
+			item := gin.H{
+				"request_id": request.ID.Hex(),
+				"user":       profile,
+				"created_at": request.Created_At,
+			}
+			if *request.Addressee_ID == uid {
+				incoming = append(incoming, item)
+			} else {
+				outgoing = append(outgoing, item)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"incoming": incoming,
+			"outgoing": outgoing,
+		})
+	}
+}
+
+// RespondToFriendRequest accepts or declines a friend request sent to the caller
+func RespondToFriendRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			RequestID string `json:"request_id" binding:"required"`
+			Accept    *bool  `json:"accept" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		friendship, err := helpers.FindFriendRequest(ctx, request.RequestID)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching friend request: " + err.Error()})
+			}
+			return
+		}
+		if *friendship.Addressee_ID != uid {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+			return
+		}
+		if *friendship.Status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Friend request was already answered"})
+			return
+		}
+
+		if err := helpers.RespondToFriendRequest(ctx, friendship.ID, *request.Accept); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		message := "Friend request declined"
+		if *request.Accept {
+			message = "Friend request accepted"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
+
+// RemoveFriend ends a friendship, or withdraws a request the caller sent
+func RemoveFriend() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Uid string `json:"uid" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		removed, err := helpers.RemoveFriend(ctx, c.GetString("uid"), request.Uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Friend not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Friend removed successfully"})
+	}
+}
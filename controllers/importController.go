@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportTransactions imports expenses from a CSV file into a trip.
+// Without `commit` it only previews the import: parsed rows, how every name
+// resolves to a member and which rows were already imported. Committing
+// imports every new row or nothing, so uploading the same file again is safe.
+func ImportTransactions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID        string                 `json:"trip_id" binding:"required"`
+			CSV           string                 `json:"csv" binding:"required"`
+			Format        string                 `json:"format"`
+			Mapping       *helpers.ImportMapping `json:"mapping"`
+			MemberMap     map[string]string      `json:"member_map"`
+			AcceptFuzzy   bool                   `json:"accept_fuzzy"`
+			CreateMembers bool                   `json:"create_members"`
+			Commit        bool                   `json:"commit"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripAcceptsExpenses(c, trip) {
+			return
+		}
+
+		// Step 1: read the file
+		rows, err := helpers.ParseImportCSV(request.TripID, request.CSV, request.Format, request.Mapping, helpers.MaxImportRows())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import file: " + err.Error()})
+			return
+		}
+
+		// Step 2: resolve every name to a member of the trip
+		currency := helpers.TripCurrency(trip)
+		names := make(map[string]helpers.NameMatch)
+		newMembers := make(map[string]models.TripMember)
+		unresolved := 0
+		resolve := func(name string) {
+			if _, done := names[name]; done {
+				return
+			}
+			match := helpers.MatchMemberName(trip, name)
+			if target, ok := request.MemberMap[name]; ok {
+				match = helpers.NameMatch{Name: name, Match: "none"}
+				if member := helpers.FindTripMember(trip, target); member != nil {
+					match = helpers.NameMatch{Name: name, Member_ID: *member.Member_ID, Display_Name: *member.Display_Name, Match: "mapped", Score: 1}
+				}
+			}
+			if match.Match == "none" || (match.Match == "fuzzy" && !request.AcceptFuzzy) {
+				if request.CreateMembers {
+					member := helpers.NewTripMember(name, nil)
+					newMembers[name] = member
+					match = helpers.NameMatch{Name: name, Member_ID: *member.Member_ID, Display_Name: name, Match: "new", Score: 1}
+				} else {
+					unresolved++
+				}
+			}
+			names[name] = match
+		}
+
+		newCategories := make([]string, 0)
+		keys := make([]string, 0, len(rows))
+		invalid := 0
+		for i := range rows {
+			row := &rows[i]
+			if row.Error == "" && row.Currency != "" && row.Currency != currency {
+				row.Error = "currency " + row.Currency + " differs from the trip currency " + currency
+			}
+			if row.Error != "" {
+				invalid++
+				continue
+			}
+			resolve(row.Payer)
+			resolve(row.Reciver)
+			// Different names can still land on one member through fuzzy matching or member_map
+			if payer, reciver := names[row.Payer], names[row.Reciver]; payer.Member_ID != "" && payer.Member_ID == reciver.Member_ID {
+				row.Error = "payer and reciever resolve to the same member"
+				invalid++
+				continue
+			}
+			if row.Category != "" && !helpers.ValidCategory(trip, row.Category) {
+				if !containsString(newCategories, row.Category) {
+					newCategories = append(newCategories, row.Category)
+				}
+			}
+			keys = append(keys, row.Key)
+		}
+
+		// Step 3: rows from an earlier upload of the same file are skipped
+		imported, err := helpers.ImportedKeys(ctx, request.TripID, keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		toImport := 0
+		for i := range rows {
+			if rows[i].Error == "" && imported[rows[i].Key] {
+				rows[i].Duplicate = true
+			} else if rows[i].Error == "" {
+				toImport++
+			}
+		}
+
+		nameList := make([]helpers.NameMatch, 0, len(names))
+		for _, match := range names {
+			nameList = append(nameList, match)
+		}
+		preview := gin.H{
+			"trip_id":        request.TripID,
+			"rows":           rows,
+			"names":          nameList,
+			"new_categories": newCategories,
+			"invalid_rows":   invalid,
+			"unresolved":     unresolved,
+			"duplicates":     len(rows) - invalid - toImport,
+			"to_import":      toImport,
+		}
+
+		if !request.Commit {
+			preview["dry_run"] = true
+			c.JSON(http.StatusOK, preview)
+			return
+		}
+		if invalid > 0 || unresolved > 0 {
+			preview["error"] = "Fix the invalid rows and unresolved names before committing"
+			c.JSON(http.StatusUnprocessableEntity, preview)
+			return
+		}
+		if toImport == 0 {
+			preview["message"] = "Nothing new to import"
+			c.JSON(http.StatusOK, preview)
+			return
+		}
+
+		// Step 4: build the transactions
+		now := time.Now()
+		isDeleted := false
+		transactions := make([]models.Transaction, 0, toImport)
+		for _, row := range rows {
+			if row.Error != "" || row.Duplicate {
+				continue
+			}
+			payer, reciver := names[row.Payer], names[row.Reciver]
+			amount := strconv.FormatFloat(row.Amount, 'f', -1, 64)
+			t := models.Transaction{
+				ID:          primitive.NewObjectID(),
+				Trip_ID:     &request.TripID,
+				PayerName:   stringPtr(payer.Display_Name),
+				ReciverName: stringPtr(reciver.Display_Name),
+				Payer_ID:    stringPtr(payer.Member_ID),
+				Reciver_ID:  stringPtr(reciver.Member_ID),
+				Amount:      &amount,
+				Description: stringPtr(row.Description),
+				IsDeleted:   &isDeleted,
+				Type:        stringPtr(row.Type),
+				Import_Key:  stringPtr(row.Key),
+				Created_At:  row.Date,
+				Version:     1,
+			}
+			if row.Category != "" {
+				t.Category = stringPtr(row.Category)
+			}
+			if t.Created_At.IsZero() {
+				t.Created_At = now
+			}
+			transactions = append(transactions, t)
+		}
+
+		// Step 5: add the members and categories the file needs and save the
+		// transactions, all of it or nothing
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if len(newMembers) > 0 {
+				memberList := make([]models.TripMember, 0, len(newMembers))
+				memberNames := make([]string, 0, len(newMembers))
+				memberIDs := make([]string, 0, len(newMembers))
+				for name, member := range newMembers {
+					memberList = append(memberList, member)
+					memberNames = append(memberNames, name)
+					memberIDs = append(memberIDs, *member.Member_ID)
+				}
+				_, err := tripCollection.UpdateOne(ctx,
+					bson.M{"trip_id": request.TripID},
+					helpers.BumpVersion(bson.M{"$push": bson.M{
+						"member_list": bson.M{"$each": memberList},
+						"members":     bson.M{"$each": memberNames},
+					}}),
+				)
+				if err != nil {
+					return fmt.Errorf("Failed to add members: %w", err)
+				}
+				helpers.OnRollback(ctx, func(ctx context.Context) error {
+					_, err := tripCollection.UpdateOne(ctx,
+						bson.M{"trip_id": request.TripID},
+						helpers.BumpVersion(bson.M{"$pull": bson.M{
+							"member_list": bson.M{"member_id": bson.M{"$in": memberIDs}},
+							"members":     bson.M{"$in": memberNames},
+						}}),
+					)
+					return err
+				})
+			}
+			if len(newCategories) > 0 {
+				_, err := tripCollection.UpdateOne(ctx,
+					bson.M{"trip_id": request.TripID},
+					helpers.BumpVersion(bson.M{"$addToSet": bson.M{"categories": bson.M{"$each": newCategories}}}),
+				)
+				if err != nil {
+					return fmt.Errorf("Failed to add categories: %w", err)
+				}
+				helpers.OnRollback(ctx, func(ctx context.Context) error {
+					_, err := tripCollection.UpdateOne(ctx,
+						bson.M{"trip_id": request.TripID},
+						helpers.BumpVersion(bson.M{"$pullAll": bson.M{"categories": newCategories}}),
+					)
+					return err
+				})
+			}
+
+			if err := helpers.InsertImportedTransactions(ctx, transactions); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "TRANSACTIONS_IMPORTED", uid, "", map[string]interface{}{
+				"count":  len(transactions),
+				"format": request.Format,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		preview["message"] = "Transactions imported successfully"
+		preview["imported"] = len(transactions)
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,533 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RotateInviteCode replaces a trip's invite code, invalidating the old one
+func RotateInviteCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID         string `json:"trip_id" binding:"required"`
+			ExpiresInHours *int   `json:"expires_in_hours"`
+			MaxUses        *int   `json:"max_uses"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		if (request.ExpiresInHours != nil && *request.ExpiresInHours < 1) || (request.MaxUses != nil && *request.MaxUses < 1) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_hours and max_uses must be positive"})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can rotate the invite code"})
+			return
+		}
+
+		var expiresAt *time.Time
+		if request.ExpiresInHours != nil {
+			t := time.Now().Add(time.Duration(*request.ExpiresInHours) * time.Hour)
+			expiresAt = &t
+		}
+
+		var code string
+		err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if code, err = helpers.RotateInvite(ctx, request.TripID, expiresAt, request.MaxUses); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "INVITE_ROTATED", uid, "", nil)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate invite code: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":           "Invite code rotated successfully",
+			"invite_code":       code,
+			"invite_link":       helpers.InviteLink(code),
+			"invite_expires_at": expiresAt,
+			"invite_max_uses":   request.MaxUses,
+		})
+	}
+}
+
+// RevokeInviteCode stops a trip's invite code from being used until it is rotated
+func RevokeInviteCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can revoke the invite code"})
+			return
+		}
+
+		err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			_, err := tripCollection.UpdateOne(ctx,
+				bson.M{"trip_id": request.TripID},
+				helpers.BumpVersion(bson.M{"$set": bson.M{"invite_revoked": true}}),
+			)
+			if err != nil {
+				return err
+			}
+			wasRevoked := trip.Invite_Revoked != nil && *trip.Invite_Revoked
+			helpers.OnRollback(ctx, func(ctx context.Context) error {
+				_, err := tripCollection.UpdateOne(ctx, bson.M{"trip_id": request.TripID}, helpers.BumpVersion(bson.M{"$set": bson.M{"invite_revoked": wasRevoked}}))
+				return err
+			})
+			return helpers.RecordTripEvent(ctx, request.TripID, "INVITE_REVOKED", uid, "", nil)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite code: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Invite code revoked successfully"})
+	}
+}
+
+// InviteUser lets a trip admin invite a registered user by uid, email or phone
+func InviteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID   string  `json:"trip_id" binding:"required"`
+			Uid      string  `json:"uid"`
+			Email    string  `json:"email"`
+			Phone    string  `json:"phone"`
+			MemberID *string `json:"member_id"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can invite users"})
+			return
+		}
+
+		// Find the invitee
+		var invitee models.User
+		var err error
+		switch {
+		case request.Uid != "":
+			err = userCollection.FindOne(ctx, bson.M{"user_id": request.Uid, "is_deleted": bson.M{"$ne": true}}).Decode(&invitee)
+		case request.Email != "":
+			err = userCollection.FindOne(ctx, bson.M{"email": request.Email, "is_deleted": bson.M{"$ne": true}}).Decode(&invitee)
+		case request.Phone != "":
+			invitee, err = helpers.FindUserByPhone(ctx, request.Phone)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "One of uid, email or phone is required"})
+			return
+		}
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No registered user found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user: " + err.Error()})
+			}
+			return
+		}
+
+		if helpers.TripMemberOfUser(trip, *invitee.User_id) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is already a member of this trip"})
+			return
+		}
+		if request.MemberID != nil {
+			member := helpers.FindTripMember(trip, *request.MemberID)
+			if member == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+				return
+			}
+			if member.Uid != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": helpers.ErrMemberAlreadyLinked.Error()})
+				return
+			}
+			request.MemberID = member.Member_ID
+		}
+
+		invitation, err := helpers.CreateTripInvitation(ctx, "INVITE", request.TripID, *invitee.User_id, request.MemberID, uid)
+		if err != nil {
+			if err == helpers.ErrInvitationPending {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":    "Invitation sent successfully",
+			"invitation": invitation,
+			"invitee":    invitee.Public(),
+		})
+	}
+}
+
+// GetMyInvitations is the caller's inbox of pending trip invitations
+func GetMyInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		invitations, err := helpers.ListTripInvitations(ctx, bson.M{"uid": uid, "kind": "INVITE"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invitations: " + err.Error()})
+			return
+		}
+
+		// Add the trip names so the inbox can be shown without another round trip
+		items := make([]gin.H, 0, len(invitations))
+		for _, invitation := range invitations {
+			var trip models.Trip
+			if err := tripCollection.FindOne(ctx, bson.M{"trip_id": invitation.Trip_ID}).Decode(&trip); err != nil {
+				continue
+			}
+			items = append(items, gin.H{
+				"invitation": invitation,
+				"trip_name":  trip.Name,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": len(items),
+			"invitations": items,
+		})
+	}
+}
+
+// RespondToInvitation accepts or declines an invitation in the caller's inbox
+func RespondToInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			InvitationID string `json:"invitation_id" binding:"required"`
+			Accept       *bool  `json:"accept" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		invitation, err := helpers.FindTripInvitation(ctx, request.InvitationID)
+		if err != nil || *invitation.Kind != "INVITE" || *invitation.Uid != uid {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		if *invitation.Status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation was already answered"})
+			return
+		}
+
+		if !*request.Accept {
+			err := helpers.SetInvitationStatus(ctx, invitation.ID, "DECLINED")
+			if err == helpers.ErrInvitationAnswered {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Invitation declined"})
+			return
+		}
+
+		firstName, lastName := c.GetString("first_name"), c.GetString("last_name")
+		displayName := helpers.MemberDisplayName(&firstName, &lastName, "member_"+uid)
+		var member models.TripMember
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if member, err = helpers.AcceptTripInvitation(ctx, invitation, displayName); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, *invitation.Trip_ID, "INVITATION_ACCEPTED", uid, *member.Member_ID, nil)
+		})
+		if err != nil {
+			if err == helpers.ErrMemberAlreadyLinked || err == helpers.ErrUserAlreadyLinked || err == helpers.ErrTripArchived || err == helpers.ErrInvitationAnswered {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation: " + err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Invitation accepted",
+			"trip_id":   invitation.Trip_ID,
+			"member_id": member.Member_ID,
+		})
+	}
+}
+
+// SetApprovalRequired switches a trip between open invite-code joins and
+// joins that wait for an admin's approval
+func SetApprovalRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID           string `json:"trip_id" binding:"required"`
+			ApprovalRequired *bool  `json:"approval_required" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can change join approval"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		result, err := tripCollection.UpdateOne(ctx,
+			helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected),
+			helpers.BumpVersion(bson.M{"$set": bson.M{"approval_required": *request.ApprovalRequired}}),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trip: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":           "Join approval updated",
+			"approval_required": *request.ApprovalRequired,
+		})
+	}
+}
+
+// GetJoinRequests lists the pending join requests of a trip for its admins
+func GetJoinRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can see join requests"})
+			return
+		}
+
+		joinRequests, err := helpers.ListTripInvitations(ctx, bson.M{"trip_id": request.TripID, "kind": "JOIN_REQUEST"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching join requests: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count":   len(joinRequests),
+			"join_requests": joinRequests,
+		})
+	}
+}
+
+// RespondToJoinRequest lets a trip admin approve or reject a join request
+func RespondToJoinRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			RequestID string `json:"request_id" binding:"required"`
+			Approve   *bool  `json:"approve" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		joinRequest, err := helpers.FindTripInvitation(ctx, request.RequestID)
+		if err != nil || *joinRequest.Kind != "JOIN_REQUEST" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Join request not found"})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, *joinRequest.Trip_ID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can answer join requests"})
+			return
+		}
+		if *joinRequest.Status != "PENDING" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Join request was already answered"})
+			return
+		}
+
+		if !*request.Approve {
+			err := helpers.SetInvitationStatus(ctx, joinRequest.ID, "DECLINED")
+			if err == helpers.ErrInvitationAnswered {
+				c.JSON(http.StatusConflict, gin.H{"error": "Join request was already answered"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Join request rejected"})
+			return
+		}
+
+		var member models.TripMember
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if member, err = helpers.AcceptTripInvitation(ctx, joinRequest, ""); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, *joinRequest.Trip_ID, "JOIN_REQUEST_APPROVED", uid, *member.Member_ID, map[string]interface{}{
+				"uid": *joinRequest.Uid,
+			})
+		})
+		if err != nil {
+			if err == helpers.ErrInvitationAnswered {
+				c.JSON(http.StatusConflict, gin.H{"error": "Join request was already answered"})
+			} else if err == helpers.ErrMemberAlreadyLinked || err == helpers.ErrUserAlreadyLinked {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve join request: " + err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Join request approved",
+			"member_id": member.Member_ID,
+		})
+	}
+}
+
+// requestToJoin turns an invite-code join into a join request when the trip
+// requires approval. It reports whether it handled the request.
+func requestToJoin(ctx context.Context, c *gin.Context, trip models.Trip, member models.TripMember, uid string) bool {
+	if trip.Approval_Required == nil || !*trip.Approval_Required || helpers.IsTripAdmin(trip, c.GetString("uid")) {
+		return false
+	}
+
+	if member.Uid != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.ErrMemberAlreadyLinked.Error()})
+		return true
+	}
+	if helpers.TripMemberOfUser(trip, uid) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": helpers.ErrUserAlreadyLinked.Error()})
+		return true
+	}
+
+	var joinRequest models.TripInvitation
+	err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		joinRequest, err = helpers.CreateTripInvitation(ctx, "JOIN_REQUEST", *trip.Trip_ID, uid, member.Member_ID, uid)
+		if err != nil {
+			return err
+		}
+		return helpers.ConsumeInvite(ctx, trip)
+	})
+	if err != nil {
+		switch err {
+		case helpers.ErrInvitationPending:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case helpers.ErrInviteUsedUp:
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return true
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Join request sent, a trip admin has to approve it",
+		"join_request": joinRequest,
+	})
+	return true
+}
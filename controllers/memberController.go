@@ -0,0 +1,491 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// loadTripForMember fetches a trip and the caller's member in it, writing the
+// error response itself when either is missing
+func loadTripForMember(ctx context.Context, c *gin.Context, tripID string) (models.Trip, *models.TripMember, bool) {
+	uid := c.GetString("uid")
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return models.Trip{}, nil, false
+	}
+
+	trip, err := helpers.FindTrip(ctx, bson.M{"trip_id": tripID})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+		}
+		return trip, nil, false
+	}
+
+	caller := helpers.TripMemberOfUser(trip, uid)
+	if caller == nil && !helpers.IsTripAdmin(trip, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this trip"})
+		return trip, nil, false
+	}
+	return trip, caller, true
+}
+
+func AddTripMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+			Name   string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member name cannot be empty"})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		member := helpers.NewTripMember(name, nil)
+		result, err := tripCollection.UpdateOne(ctx,
+			helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected),
+			helpers.BumpVersion(bson.M{"$push": bson.M{
+				"member_list": member,
+				"members":     name,
+			}}),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Member added successfully",
+			"trip_id":   trip.Trip_ID,
+			"member":    member,
+			"member_id": member.Member_ID,
+		})
+	}
+}
+
+// RenameTripMember renames a member everywhere it appears.
+// Trip admins can rename anyone, other users only the member they are linked to.
+func RenameTripMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID   string `json:"trip_id" binding:"required"`
+			MemberID string `json:"member_id" binding:"required"`
+			Name     string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member name cannot be empty"})
+			return
+		}
+
+		trip, caller, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+
+		member := helpers.FindTripMember(trip, request.MemberID)
+		if member == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+			return
+		}
+
+		isSelf := caller != nil && *caller.Member_ID == *member.Member_ID
+		if !isSelf && !helpers.IsTripAdmin(trip, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can rename other members"})
+			return
+		}
+		// Names are how members are told apart in the legacy `members` list and
+		// in lookups by name, so no two may share one
+		if helpers.MemberNameTaken(trip, *member.Member_ID, name) {
+			c.JSON(http.StatusConflict, gin.H{"error": helpers.ErrMemberNameTaken.Error()})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		err := helpers.RenameTripMember(ctx, request.TripID, *member.Member_ID, *member.Display_Name, name, expected)
+		if err == helpers.ErrMemberNameTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err == helpers.ErrStaleVersion {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename member: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Member renamed successfully",
+			"member_id": member.Member_ID,
+			"old_name":  member.Display_Name,
+			"name":      name,
+		})
+	}
+}
+
+// RemoveTripMember takes a member off the trip.
+// A member who still owes or is owed money can only be removed when their
+// transactions are reassigned to another member with `reassign_to`.
+func RemoveTripMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID     string `json:"trip_id" binding:"required"`
+			MemberID   string `json:"member_id" binding:"required"`
+			ReassignTo string `json:"reassign_to"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can remove members"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		member := helpers.FindTripMember(trip, request.MemberID)
+		if member == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+			return
+		}
+		if trip.Creator_ID != nil && member.Uid != nil && *member.Uid == *trip.Creator_ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The trip creator can't be removed"})
+			return
+		}
+
+		transactions, err := helpers.TripTransactions(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+			return
+		}
+		balances, _ := helpers.MemberBalances(transactions)
+		balance := helpers.MemberBalance(balances, *member)
+
+		if request.ReassignTo != "" {
+			target := helpers.FindTripMember(trip, request.ReassignTo)
+			if target == nil || *target.Member_ID == *member.Member_ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must be another member of this trip"})
+				return
+			}
+		} else if math.Abs(balance) > 0.01 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Member has an unsettled balance, settle up or pass reassign_to",
+				"balance": balance,
+			})
+			return
+		}
+
+		remaining := make([]models.TripMember, 0, len(*trip.Member_List))
+		for _, m := range *trip.Member_List {
+			if *m.Member_ID != *member.Member_ID {
+				remaining = append(remaining, m)
+			}
+		}
+
+		// Reassigning, removing and unlinking happen together or not at all
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if request.ReassignTo != "" {
+				target := helpers.FindTripMember(trip, request.ReassignTo)
+				if err := helpers.ReassignMemberTransactions(ctx, request.TripID, *member, *target); err != nil {
+					return fmt.Errorf("Failed to reassign transactions: %w", err)
+				}
+			}
+
+			result, err := tripCollection.UpdateOne(ctx,
+				helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected),
+				helpers.BumpVersion(bson.M{"$set": bson.M{
+					"member_list": remaining,
+					"members":     helpers.MemberNames(remaining),
+				}}),
+			)
+			if err != nil {
+				return fmt.Errorf("Failed to remove member: %w", err)
+			}
+			if result.MatchedCount == 0 {
+				return helpers.ErrStaleVersion
+			}
+			helpers.OnRollback(ctx, func(ctx context.Context) error {
+				_, err := tripCollection.UpdateOne(ctx,
+					bson.M{"trip_id": request.TripID},
+					helpers.BumpVersion(bson.M{"$set": bson.M{"member_list": *trip.Member_List, "members": trip.Members}}),
+				)
+				return err
+			})
+
+			if err := helpers.UnlinkTripMember(ctx, request.TripID, *member); err != nil {
+				return fmt.Errorf("Failed to remove member link: %w", err)
+			}
+			return nil
+		})
+		if err == helpers.ErrStaleVersion {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Member removed successfully",
+			"member_id":   member.Member_ID,
+			"reassign_to": request.ReassignTo,
+		})
+	}
+}
+
+// UnlinkMember releases a member placeholder.
+// Allowed for the user linked to it and for trip admins.
+func UnlinkMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID   string `json:"trip_id" binding:"required"`
+			MemberID string `json:"member_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, caller, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+
+		member := helpers.FindTripMember(trip, request.MemberID)
+		if member == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+			return
+		}
+		if member.Uid == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is not linked"})
+			return
+		}
+
+		isSelf := caller != nil && *caller.Member_ID == *member.Member_ID
+		if !isSelf && !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the linked user or a trip admin can unlink this member"})
+			return
+		}
+
+		err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := helpers.UnlinkTripMember(ctx, request.TripID, *member); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "MEMBER_UNLINKED", uid, *member.Member_ID, map[string]interface{}{
+				"uid": *member.Uid,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink member: " + err.Error()})
+			return
+		}
+
+		trip, err = helpers.FindTrip(ctx, bson.M{"trip_id": request.TripID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+			return
+		}
+		free, notFree := helpers.GetAllFreeMembers(trip)
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "Member unlinked successfully",
+			"member_id":        member.Member_ID,
+			"free_members":     free,
+			"not_free_members": notFree,
+		})
+	}
+}
+
+// TransferMemberClaim lets a trip admin hand a member placeholder to a different user
+func TransferMemberClaim() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID   string `json:"trip_id" binding:"required"`
+			MemberID string `json:"member_id" binding:"required"`
+			Uid      string `json:"uid" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can transfer a member claim"})
+			return
+		}
+
+		member := helpers.FindTripMember(trip, request.MemberID)
+		if member == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+			return
+		}
+		if member.Uid != nil && *member.Uid == request.Uid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is already linked to this user"})
+			return
+		}
+
+		count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": request.Uid, "is_deleted": bson.M{"$ne": true}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user: " + err.Error()})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if helpers.TripMemberOfUser(trip, request.Uid) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User is already linked with another member in this trip"})
+			return
+		}
+
+		previousUid := ""
+		if member.Uid != nil {
+			previousUid = *member.Uid
+		}
+		// The previous user keeps the member when the new claim fails
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := helpers.UnlinkTripMember(ctx, request.TripID, *member); err != nil {
+				return err
+			}
+			unlinked := *member
+			unlinked.Uid = nil
+			if err := helpers.ClaimTripMember(ctx, trip, unlinked, request.Uid); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "CLAIM_TRANSFERRED", uid, *member.Member_ID, map[string]interface{}{
+				"from_uid": previousUid,
+				"to_uid":   request.Uid,
+			})
+		})
+		if err != nil {
+			if err == helpers.ErrMemberAlreadyLinked || err == helpers.ErrUserAlreadyLinked {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer member claim: " + err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Member claim transferred successfully",
+			"member_id": member.Member_ID,
+			"from_uid":  previousUid,
+			"to_uid":    request.Uid,
+		})
+	}
+}
+
+// GetTripEvents returns the audit trail of a trip to its members
+func GetTripEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		if _, _, ok := loadTripForMember(ctx, c, request.TripID); !ok {
+			return
+		}
+
+		events, err := helpers.TripEvents(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching trip events: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": len(events),
+			"events":      events,
+		})
+	}
+}
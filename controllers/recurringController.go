@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateRecurringExpense sets up an expense that repeats on a schedule
+func CreateRecurringExpense() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID       string             `json:"trip_id" binding:"required"`
+			Description  string             `json:"description" binding:"required"`
+			Category     *string            `json:"category"`
+			Amount       string             `json:"amount" binding:"required"`
+			PaidBy       string             `json:"paid_by" binding:"required"`
+			Participants []string           `json:"participants" binding:"required"`
+			SplitRule    string             `json:"split_rule"`
+			SplitValues  map[string]float64 `json:"split_values"`
+			Frequency    string             `json:"frequency" binding:"required"`
+			Interval     int                `json:"interval"`
+			Cron         *string            `json:"cron"`
+			StartAt      *time.Time         `json:"start_at"`
+			EndAt        *time.Time         `json:"end_at"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripAcceptsExpenses(c, trip) {
+			return
+		}
+
+		// Step 1: resolve the payer and participants to member ids
+		payer := helpers.FindTripMember(trip, request.PaidBy)
+		if payer == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payer is not a member of this trip"})
+			return
+		}
+		participants := make([]string, 0, len(request.Participants))
+		splitValues := make(map[string]float64, len(request.SplitValues))
+		for _, idOrName := range request.Participants {
+			member := helpers.FindTripMember(trip, idOrName)
+			if member == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Participant is not a member of this trip: " + idOrName})
+				return
+			}
+			if containsString(participants, *member.Member_ID) {
+				continue
+			}
+			participants = append(participants, *member.Member_ID)
+			if value, ok := request.SplitValues[idOrName]; ok {
+				splitValues[*member.Member_ID] = value
+			}
+		}
+		if len(splitValues) != len(request.SplitValues) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "split_values must be keyed by the participants"})
+			return
+		}
+
+		// Step 2: validate amount, split and schedule
+		total, err := strconv.ParseFloat(request.Amount, 64)
+		if err != nil || total <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+			return
+		}
+		if request.SplitRule == "" {
+			request.SplitRule = "equal"
+		}
+		if _, err := helpers.ComputeSplit(total, participants, request.SplitRule, splitValues); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid split: " + err.Error()})
+			return
+		}
+		if request.Category != nil {
+			category := helpers.NormalizeCategory(*request.Category)
+			if !helpers.ValidCategory(trip, category) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category: " + *request.Category})
+				return
+			}
+			request.Category = &category
+		}
+		if request.Interval == 0 {
+			request.Interval = 1
+		}
+		startAt := time.Now().UTC().Truncate(time.Minute)
+		if request.StartAt != nil {
+			startAt = *request.StartAt
+		}
+
+		template := models.RecurringExpense{
+			ID:           primitive.NewObjectID(),
+			Trip_ID:      &request.TripID,
+			Created_By:   &uid,
+			Description:  &request.Description,
+			Category:     request.Category,
+			Amount:       &request.Amount,
+			Paid_By:      payer.Member_ID,
+			Participants: participants,
+			Split_Rule:   &request.SplitRule,
+			Split_Values: splitValues,
+			Frequency:    &request.Frequency,
+			Interval:     request.Interval,
+			Cron:         request.Cron,
+			Start_At:     startAt,
+			End_At:       request.EndAt,
+			Created_At:   time.Now(),
+		}
+		if err := helpers.ValidateRecurringSchedule(template); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule: " + err.Error()})
+			return
+		}
+		next, ok := helpers.OccurrenceFrom(template, startAt)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The schedule has no occurrences"})
+			return
+		}
+		template.Next_Run_At = &next
+
+		if err := helpers.SaveRecurringExpense(ctx, template); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recurring expense: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":           "Recurring expense created successfully",
+			"recurring_expense": template,
+		})
+	}
+}
+
+// GetRecurringExpenses lists a trip's recurring expenses
+func GetRecurringExpenses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		if _, _, ok := loadTripForMember(ctx, c, request.TripID); !ok {
+			return
+		}
+		templates, err := helpers.ListRecurringExpenses(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching recurring expenses: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total_count":        len(templates),
+			"recurring_expenses": templates,
+		})
+	}
+}
+
+// PauseRecurringExpense pauses or resumes a recurring expense. Resuming does
+// not back-fill the occurrences missed while paused.
+func PauseRecurringExpense() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID      string `json:"trip_id" binding:"required"`
+			RecurringID string `json:"recurring_id" binding:"required"`
+			Paused      *bool  `json:"paused" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		template, err := helpers.FindRecurringExpense(ctx, request.TripID, request.RecurringID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring expense not found"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{"paused": *request.Paused}}
+		if !*request.Paused {
+			if next, ok := helpers.OccurrenceFrom(template, time.Now()); ok {
+				update["$set"].(bson.M)["next_run_at"] = next
+			} else {
+				update["$unset"] = bson.M{"next_run_at": ""}
+			}
+		}
+		if err := helpers.UpdateRecurringExpense(ctx, template.ID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recurring expense: " + err.Error()})
+			return
+		}
+
+		message := "Recurring expense resumed"
+		if *request.Paused {
+			message = "Recurring expense paused"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
+
+// DeleteRecurringExpense stops a recurring expense. Occurrences already
+// recorded stay in the ledger.
+func DeleteRecurringExpense() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID      string `json:"trip_id" binding:"required"`
+			RecurringID string `json:"recurring_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		template, err := helpers.FindRecurringExpense(ctx, request.TripID, request.RecurringID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring expense not found"})
+			return
+		}
+		if *template.Created_By != uid && !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only its creator or a trip admin can delete a recurring expense"})
+			return
+		}
+
+		if err := helpers.UpdateRecurringExpense(ctx, template.ID, bson.M{
+			"$set":   bson.M{"is_deleted": true},
+			"$unset": bson.M{"next_run_at": ""},
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring expense: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Recurring expense deleted successfully"})
+	}
+}
+
+// UpdateRecurringOccurrence skips or edits a single occurrence of a recurring expense
+func UpdateRecurringOccurrence() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID       string    `json:"trip_id" binding:"required"`
+			RecurringID  string    `json:"recurring_id" binding:"required"`
+			OccurrenceAt time.Time `json:"occurrence_at" binding:"required"`
+			Skip         bool      `json:"skip"`
+			Amount       *string   `json:"amount"`
+			Description  *string   `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		if !request.Skip && request.Amount == nil && request.Description == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to change: set skip, amount or description"})
+			return
+		}
+		if request.Amount != nil {
+			if amount, err := strconv.ParseFloat(*request.Amount, 64); err != nil || amount <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+				return
+			}
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		// Skipping or editing rewrites expense transactions already saved
+		if !requireTripAcceptsExpenses(c, trip) {
+			return
+		}
+		template, err := helpers.FindRecurringExpense(ctx, request.TripID, request.RecurringID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recurring expense not found"})
+			return
+		}
+		if at, ok := helpers.OccurrenceFrom(template, request.OccurrenceAt); !ok || !at.Equal(request.OccurrenceAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "occurrence_at is not an occurrence of this recurring expense"})
+			return
+		}
+
+		exception := models.RecurringException{
+			Occurrence_At: request.OccurrenceAt,
+			Skip:          request.Skip,
+			Amount:        request.Amount,
+			Description:   request.Description,
+		}
+		updated, err := helpers.SetOccurrenceException(ctx, trip, template, exception)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update occurrence: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":              "Occurrence updated successfully",
+			"exception":            exception,
+			"updated_transactions": updated,
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetTripReminders configures the settle-up emails of a trip
+func SetTripReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID       string  `json:"trip_id" binding:"required"`
+			Mode         string  `json:"mode" binding:"required"`
+			DaysAfterEnd *int    `json:"days_after_end"`
+			EndDate      *string `json:"end_date"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		if !helpers.ValidReminderMode(request.Mode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be one of off, weekly or after_end"})
+			return
+		}
+		if request.DaysAfterEnd != nil && (*request.DaysAfterEnd < 0 || *request.DaysAfterEnd > 365) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days_after_end must be between 0 and 365"})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can change reminders"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		endDate := trip.End_Date
+		if request.EndDate != nil {
+			day, err := helpers.ParseTripDate(*request.EndDate, helpers.TripLocation(trip))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date: " + err.Error()})
+				return
+			}
+			if trip.Start_Date != nil && day.Before(*trip.Start_Date) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_date can't be before start_date"})
+				return
+			}
+			endDate = &day
+		}
+		if request.Mode == helpers.ReminderAfterEnd && endDate == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The trip needs an end_date for after_end reminders"})
+			return
+		}
+
+		mode := request.Mode
+		settings := models.ReminderSettings{Mode: &mode}
+		if request.Mode == helpers.ReminderAfterEnd {
+			days := 1
+			if request.DaysAfterEnd != nil {
+				days = *request.DaysAfterEnd
+			}
+			settings.Days_After_End = &days
+		}
+		set := bson.M{"reminders": settings}
+		if request.EndDate != nil {
+			set["end_date"] = *endDate
+		}
+
+		result, err := tripCollection.UpdateOne(ctx, helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected), helpers.BumpVersion(bson.M{"$set": set}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reminders: " + err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Reminders updated successfully",
+			"reminders": settings,
+			"end_date":  endDate,
+		})
+	}
+}
+
+// NudgeMember lets a creditor email a debtor the transfers they owe them
+func NudgeMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID   string `json:"trip_id" binding:"required"`
+			MemberID string `json:"member_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, caller, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if caller == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You need to be linked to a member to nudge"})
+			return
+		}
+		debtor := helpers.FindTripMember(trip, request.MemberID)
+		if debtor == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		if debtor.Uid == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is not linked to a user"})
+			return
+		}
+
+		transactions, err := helpers.TripTransactions(ctx, request.TripID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+			return
+		}
+		var owed []helpers.Settlement
+		for _, s := range helpers.TransfersByDebtor(helpers.CalculateSettlements(transactions))[*debtor.Member_ID] {
+			if s.To_ID == *caller.Member_ID {
+				owed = append(owed, s)
+			}
+		}
+		if len(owed) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This member doesn't owe you anything"})
+			return
+		}
+
+		now := time.Now()
+		muted, err := helpers.RemindersMuted(ctx, *debtor.Uid, request.TripID, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reminder preferences: " + err.Error()})
+			return
+		}
+		if muted {
+			c.JSON(http.StatusConflict, gin.H{"error": "This member has turned off reminders"})
+			return
+		}
+
+		// The slot is taken before the email goes out, so requests racing each
+		// other send one email between them
+		claimed, previous, err := helpers.ClaimNudge(ctx, request.TripID, *caller.Member_ID, *debtor.Member_ID, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking previous nudges: " + err.Error()})
+			return
+		}
+		if !claimed {
+			next := previous.Add(helpers.NudgeCooldown())
+			if wait := next.Sub(now); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":          "You already nudged this member recently",
+				"next_nudge_at":  next,
+				"last_nudged_at": previous,
+			})
+			return
+		}
+
+		intro := *caller.Display_Name + " sent you a reminder about what you owe them:"
+		if err := helpers.SendTransferReminder(ctx, trip, *debtor, owed, intro); err != nil {
+			if releaseErr := helpers.ReleaseNudge(ctx, request.TripID, *caller.Member_ID, *debtor.Member_ID, now, previous); releaseErr != nil {
+				log.Printf("Could not release nudge of %s: %v", *debtor.Member_ID, releaseErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reminder: " + err.Error()})
+			return
+		}
+		if err := helpers.RecordTripEvent(ctx, request.TripID, "MEMBER_NUDGED", c.GetString("uid"), *debtor.Member_ID, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record nudge: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Reminder sent successfully",
+			"next_nudge_at": now.Add(helpers.NudgeCooldown()),
+		})
+	}
+}
+
+// reminderPage is the small page shown after following a link from a reminder email
+func reminderPage(c *gin.Context, status int, message string) {
+	page := "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>Reminders</title></head><body><p>" +
+		html.EscapeString(message) + "</p></body></html>"
+	c.Data(status, "text/html; charset=utf-8", []byte(page))
+}
+
+// reminderConfirmPage asks before a reminder link changes anything. Mail
+// scanners and link previews open links with GET, only the button posts.
+// The form posts back to the same URL, token included.
+func reminderConfirmPage(c *gin.Context, question, button string) {
+	page := "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>Reminders</title></head><body><p>" +
+		html.EscapeString(question) + "</p><form method=\"post\"><button type=\"submit\">" +
+		html.EscapeString(button) + "</button></form></body></html>"
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// reminderLinkUser checks the token of a reminder link and returns who it was sent to
+func reminderLinkUser(c *gin.Context, action string) (uid, tripID string, ok bool) {
+	tokenAction, uid, tripID, err := helpers.ParseReminderToken(c.Query("token"))
+	if err != nil || tokenAction != action {
+		reminderPage(c, http.StatusBadRequest, "This link is invalid or has expired.")
+		return "", "", false
+	}
+	return uid, tripID, true
+}
+
+// snoozeDays reads how long a snooze link mutes reminders for
+func snoozeDays(c *gin.Context) (int, bool) {
+	days := helpers.ReminderSnoozeDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 90 {
+			reminderPage(c, http.StatusBadRequest, "Reminders can be snoozed for 1 to 90 days.")
+			return 0, false
+		}
+		days = parsed
+	}
+	return days, true
+}
+
+// ConfirmSnoozeReminders is where the snooze link in a reminder email lands
+func ConfirmSnoozeReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, _, ok := reminderLinkUser(c, helpers.ReminderActionSnooze); !ok {
+			return
+		}
+		days, ok := snoozeDays(c)
+		if !ok {
+			return
+		}
+		reminderConfirmPage(c, "Snooze the reminders for this trip for "+strconv.Itoa(days)+" days?", "Snooze reminders")
+	}
+}
+
+// SnoozeReminders mutes the reminders of a trip once the snooze link is confirmed
+func SnoozeReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid, tripID, ok := reminderLinkUser(c, helpers.ReminderActionSnooze)
+		if !ok {
+			return
+		}
+		days, ok := snoozeDays(c)
+		if !ok {
+			return
+		}
+
+		until := time.Now().AddDate(0, 0, days)
+		if err := helpers.SnoozeReminders(ctx, uid, tripID, until); err != nil {
+			reminderPage(c, http.StatusInternalServerError, "Something went wrong, please try again later.")
+			return
+		}
+		reminderPage(c, http.StatusOK, "Reminders for this trip are snoozed until "+until.Format("2 January 2006")+".")
+	}
+}
+
+// ConfirmUnsubscribeReminders is where the unsubscribe link in a reminder email lands
+func ConfirmUnsubscribeReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, _, ok := reminderLinkUser(c, helpers.ReminderActionUnsubscribe); !ok {
+			return
+		}
+		question := "Stop the reminders for this trip?"
+		if c.Query("all") == "true" {
+			question = "Stop all reminders?"
+		}
+		reminderConfirmPage(c, question, "Unsubscribe")
+	}
+}
+
+// UnsubscribeReminders stops the reminders of a trip once the unsubscribe link is confirmed
+func UnsubscribeReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid, tripID, ok := reminderLinkUser(c, helpers.ReminderActionUnsubscribe)
+		if !ok {
+			return
+		}
+		message := "You won't get any more reminders for this trip."
+		if c.Query("all") == "true" {
+			tripID = ""
+			message = "You won't get any more reminders."
+		}
+
+		if err := helpers.UnsubscribeReminders(ctx, uid, tripID); err != nil {
+			reminderPage(c, http.StatusInternalServerError, "Something went wrong, please try again later.")
+			return
+		}
+		reminderPage(c, http.StatusOK, message)
+	}
+}
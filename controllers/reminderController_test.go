@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func reminderRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/reminders/snooze", ConfirmSnoozeReminders())
+	r.GET("/reminders/unsubscribe", ConfirmUnsubscribeReminders())
+	return r
+}
+
+// Opening a reminder link must not change anything, link scanners open them too
+func TestReminderLinksOnlyAskForConfirmation(t *testing.T) {
+	r := reminderRouter()
+	for _, action := range []string{helpers.ReminderActionSnooze, helpers.ReminderActionUnsubscribe} {
+		token := helpers.ReminderToken(action, "user-1", "trip-1", time.Now().Add(time.Hour))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reminders/"+action+"?token="+url.QueryEscape(token), nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", action, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `<form method="post">`) {
+			t.Errorf("%s: no confirmation form in %q", action, w.Body.String())
+		}
+	}
+}
+
+func TestReminderLinksRejectBadTokens(t *testing.T) {
+	r := reminderRouter()
+	// A snooze token can't unsubscribe
+	token := helpers.ReminderToken(helpers.ReminderActionSnooze, "user-1", "trip-1", time.Now().Add(time.Hour))
+	for _, target := range []string{
+		"/reminders/snooze?token=forged",
+		"/reminders/unsubscribe?token=" + url.QueryEscape(token),
+		"/reminders/snooze?days=365&token=" + url.QueryEscape(token),
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, w.Code)
+		}
+	}
+}
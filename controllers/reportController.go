@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportRequest is the body shared by the trip and member reports.
+// Dates are either RFC 3339 timestamps or plain days ("2025-01-31"); a plain
+// `to` day is included in the report.
+type reportRequest struct {
+	TripID   string `json:"trip_id" binding:"required"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	MemberID string `json:"member_id"`
+	Timezone string `json:"timezone"`
+	Top      int    `json:"top"`
+}
+
+// parseDateBound reads one end of a date range, either an RFC 3339 timestamp
+// or a plain day in location. A plain day used as the upper bound includes the
+// whole day, so the bound is the start of the next one.
+func parseDateBound(value string, location *time.Location, endOfDay bool) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return nil, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, true
+}
+
+// reportFilter turns a report request into a filter, writing the error response itself
+func reportFilter(c *gin.Context, request reportRequest) (helpers.ReportFilter, bool) {
+	filter := helpers.ReportFilter{TripID: request.TripID, Timezone: request.Timezone, Top: request.Top}
+
+	location := time.UTC
+	if request.Timezone != "" {
+		loc, err := time.LoadLocation(request.Timezone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + request.Timezone})
+			return filter, false
+		}
+		location = loc
+	}
+
+	var ok bool
+	if filter.From, ok = parseDateBound(request.From, location, false); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return filter, false
+	}
+	if filter.To, ok = parseDateBound(request.To, location, true); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return filter, false
+	}
+	if request.Top < 0 || request.Top > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top must be between 0 and 100"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// GetTripReport breaks a trip's spending down by category, payer, consumer and
+// day, optionally for a date range or a single member
+func GetTripReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request reportRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		filter, ok := reportFilter(c, request)
+		if !ok {
+			return
+		}
+		if request.MemberID != "" {
+			member := helpers.FindTripMember(trip, request.MemberID)
+			if member == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in trip members"})
+				return
+			}
+			filter.MemberID = *member.Member_ID
+		}
+
+		report, err := helpers.TripSpendingReport(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report: " + err.Error()})
+			return
+		}
+
+		response := gin.H{
+			"trip_id": request.TripID,
+			"from":    filter.From,
+			"to":      filter.To,
+			"report":  report,
+		}
+		if filter.MemberID == "" && trip.Member_List != nil && len(*trip.Member_List) > 0 {
+			response["average_per_person"] = report.Total / float64(len(*trip.Member_List))
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetMyTripReport is the caller's own spending on a trip
+func GetMyTripReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request reportRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		_, caller, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if caller == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are not linked to a member of this trip"})
+			return
+		}
+		filter, ok := reportFilter(c, request)
+		if !ok {
+			return
+		}
+		filter.MemberID = *caller.Member_ID
+
+		report, err := helpers.TripSpendingReport(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"trip_id":   request.TripID,
+			"member_id": *caller.Member_ID,
+			"from":      filter.From,
+			"to":        filter.To,
+			"report":    report,
+		})
+	}
+}
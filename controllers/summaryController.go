@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyBalanceSummary shows who owes the caller overall, per trip and per
+// counterparty, across every trip the caller is linked to.
+// Positive amounts are owed to the caller. Totals are per currency, since every
+// trip has its own. Pass ?net=true to combine what the same two users owe each
+// other in different trips of the same currency.
+func GetMyBalanceSummary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		if uid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		net := c.Query("net") == "true"
+
+		positions, err := helpers.UserTripPositions(ctx, uid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error calculating balances: " + err.Error()})
+			return
+		}
+		counterparties := helpers.SummarizeCounterparties(positions, net)
+
+		owedToMe, iOwe := make(helpers.CurrencyTotals), make(helpers.CurrencyTotals)
+		for _, counterparty := range counterparties {
+			if counterparty.Amount > 0 {
+				owedToMe[counterparty.Currency] += counterparty.Amount
+			} else {
+				iOwe[counterparty.Currency] -= counterparty.Amount
+			}
+		}
+		total := make(helpers.CurrencyTotals)
+		for _, position := range positions {
+			total[position.Currency] += position.Balance
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"net_balance":    total,
+			"owed_to_me":     owedToMe,
+			"i_owe":          iOwe,
+			"netted":         net,
+			"trips":          positions,
+			"counterparties": counterparties,
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -48,6 +49,119 @@ func CreateTrip() gin.HandlerFunc {
 			return
 		}
 
+		if trip.Currency != nil {
+			currency, ok := helpers.NormalizeCurrency(*trip.Currency)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Currency must be a three letter ISO 4217 code"})
+				return
+			}
+			trip.Currency = &currency
+		}
+
+		// Custom categories and budgets may be set up front
+		if trip.Categories != nil {
+			categories := make([]string, 0, len(*trip.Categories))
+			for _, name := range *trip.Categories {
+				category := helpers.NormalizeCategory(name)
+				if category == "" || category == helpers.Uncategorized || category == "total" {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category name: " + name})
+					return
+				}
+				if !helpers.ValidCategory(models.Trip{Categories: &categories}, category) {
+					categories = append(categories, category)
+				}
+			}
+			trip.Categories = &categories
+		}
+		if trip.Total_Budget != nil && *trip.Total_Budget <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Budgets must be positive"})
+			return
+		}
+		for category, budget := range trip.Category_Budgets {
+			if !helpers.ValidCategory(trip, category) || budget <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget for category: " + category})
+				return
+			}
+		}
+
+		// Trip dates are whole days in the trip's timezone
+		if trip.Timezone != nil {
+			if _, err := time.LoadLocation(*trip.Timezone); err != nil || *trip.Timezone == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + *trip.Timezone})
+				return
+			}
+		}
+		location := helpers.TripLocation(trip)
+		if trip.Start_Date != nil {
+			day := helpers.StartOfTripDay(*trip.Start_Date, location)
+			trip.Start_Date = &day
+		}
+		if trip.End_Date != nil {
+			day := helpers.StartOfTripDay(*trip.End_Date, location)
+			trip.End_Date = &day
+		}
+		if trip.Start_Date != nil && trip.End_Date != nil && trip.End_Date.Before(*trip.Start_Date) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date can't be before start_date"})
+			return
+		}
+		if trip.Destination != nil {
+			destination := strings.TrimSpace(*trip.Destination)
+			trip.Destination = &destination
+			if destination == "" {
+				trip.Destination = nil
+			}
+		}
+		// The cover image is uploaded separately once the trip exists
+		trip.Cover_Image = nil
+
+		// Invite limits are checked like RotateInviteCode does, so a new trip
+		// can't start out with an invite nobody can use
+		if trip.Invite_Max_Uses != nil && *trip.Invite_Max_Uses < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invite_max_uses must be positive"})
+			return
+		}
+		if trip.Invite_Expires_At != nil && !trip.Invite_Expires_At.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invite_expires_at must be in the future"})
+			return
+		}
+		if trip.Reminders != nil {
+			if trip.Reminders.Mode == nil || !helpers.ValidReminderMode(*trip.Reminders.Mode) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Reminder mode must be one of off, weekly or after_end"})
+				return
+			}
+			if days := trip.Reminders.Days_After_End; days != nil && (*days < 0 || *days > 365) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "days_after_end must be between 0 and 365"})
+				return
+			}
+			if *trip.Reminders.Mode == helpers.ReminderAfterEnd {
+				if trip.End_Date == nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "The trip needs an end_date for after_end reminders"})
+					return
+				}
+				if trip.Reminders.Days_After_End == nil {
+					days := 1
+					trip.Reminders.Days_After_End = &days
+				}
+			} else {
+				trip.Reminders.Days_After_End = nil
+			}
+			trip.Reminders.Last_Sent_At = nil
+		}
+
+		// New trips start out planned or active, the rest of the lifecycle goes through SetTripStatus
+		status := helpers.TripActive
+		if trip.Status != nil && *trip.Status != "" {
+			status = *trip.Status
+		}
+		if status != helpers.TripPlanning && status != helpers.TripActive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A new trip must be planning or active"})
+			return
+		}
+		trip.Status = &status
+		trip.Status_Changed_At = nil
+		trip.Closed_At = nil
+		trip.Final_Balances = nil
+
 		fmt.Println("Getting user ID from context")
 		// 3. Extract the authenticated user's UID from the Gin context
 		creatorID := c.GetString("uid")
@@ -83,44 +197,105 @@ func CreateTrip() gin.HandlerFunc {
 			trip.Members = &[]string{}
 		}
 
+		// Every member gets a member id, the creator is linked to theirs
+		memberList := make([]models.TripMember, 0, len(*trip.Members)+1)
+		for _, name := range *trip.Members {
+			memberList = append(memberList, helpers.NewTripMember(name, nil))
+		}
+		creatorMember := helpers.NewTripMember(memberName, &creatorID)
+		memberList = append(memberList, creatorMember)
+
+		// Friends picked for the trip get a member each and an invitation to claim it
+		friendMembers := make(map[string]models.TripMember)
+		if trip.Friend_UIDs != nil {
+			profiles, err := helpers.PublicUsers(ctx, *trip.Friend_UIDs)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trip: " + err.Error()})
+				return
+			}
+			for _, friendUID := range *trip.Friend_UIDs {
+				if _, added := friendMembers[friendUID]; added {
+					continue
+				}
+				isFriend, err := helpers.AreFriends(ctx, creatorID, friendUID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trip: " + err.Error()})
+					return
+				}
+				profile, ok := profiles[friendUID]
+				if !isFriend || !ok {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Not a friend: " + friendUID})
+					return
+				}
+				friendName := helpers.MemberDisplayName(profile.First_Name, profile.Last_Name, "friend_"+friendUID)
+				friendMember := helpers.NewTripMember(friendName, nil)
+				friendMembers[friendUID] = friendMember
+				memberList = append(memberList, friendMember)
+				*trip.Members = append(*trip.Members, friendName)
+			}
+		}
+		trip.Member_List = &memberList
+
 		// Add creator as first member
 		*trip.Members = append(*trip.Members, memberName)
 
 		trip.Creator_ID = &creatorID
 
-		// Create invite code safely
-		if trip.Name != nil && trip.Trip_ID != nil {
-			invite_code := *trip.Name + *trip.Trip_ID
-			trip.Invite_Code = &invite_code
-		} else {
-			fmt.Println("Error: Cannot create invite code - name or trip_id is nil")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trip: Invalid trip data"})
+		// Create a random invite code, expiry and max uses may come with the request
+		invite_code, err := helpers.GenerateInviteCode()
+		if err != nil {
+			fmt.Println("Error: Cannot create invite code:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trip: could not generate invite code"})
 			return
 		}
+		trip.Invite_Code = &invite_code
+		inviteUses := 0
+		trip.Invite_Uses = &inviteUses
+		trip.Invite_Revoked = nil
 
 		trip.Created_At = time.Now()
+		trip.Version = 1
 
 		fmt.Println("Inserting trip into database")
-		// 7. Insert the fully populated `trip` into MongoDB:
-		insertResult, err := tripCollection.InsertOne(ctx, trip)
-		if err != nil {
-			fmt.Println("Error inserting trip:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trip: " + err.Error()})
-			return
-		}
+		// 7. Insert the trip, the creator's link and the friends' invitations as one unit
+		var insertResult *mongo.InsertOneResult
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			result, err := tripCollection.InsertOne(ctx, trip)
+			if err != nil {
+				return fmt.Errorf("Failed to create trip: %w", err)
+			}
+			insertResult = result
+			helpers.OnRollback(ctx, func(ctx context.Context) error {
+				_, err := tripCollection.DeleteOne(ctx, bson.M{"_id": trip.ID})
+				return err
+			})
 
-		// Create link for the creator
-		linkMember := models.Member{
-			ID:      primitive.NewObjectID(),
-			Trip_ID: trip.Trip_ID,
-			Name:    &memberName,
-			Uid:     &creatorID,
-		}
-		_, err = linkedMemberCollection.InsertOne(ctx, linkMember)
+			// Create link for the creator
+			linkMember := models.Member{
+				ID:        primitive.NewObjectID(),
+				Trip_ID:   trip.Trip_ID,
+				Name:      &memberName,
+				Member_ID: creatorMember.Member_ID,
+				Uid:       &creatorID,
+			}
+			if _, err := linkedMemberCollection.InsertOne(ctx, linkMember); err != nil {
+				return fmt.Errorf("Failed to link creator as member: %w", err)
+			}
+			helpers.OnRollback(ctx, func(ctx context.Context) error {
+				_, err := linkedMemberCollection.DeleteOne(ctx, bson.M{"_id": linkMember.ID})
+				return err
+			})
+
+			for friendUID, friendMember := range friendMembers {
+				if _, err := helpers.CreateTripInvitation(ctx, "INVITE", trip_id, friendUID, friendMember.Member_ID, creatorID); err != nil {
+					return fmt.Errorf("Failed to invite friend: %w", err)
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			// If linking fails, we should probably delete the trip
-			_, _ = tripCollection.DeleteOne(ctx, bson.M{"_id": trip.ID})
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link creator as member: " + err.Error()})
+			fmt.Println("Error creating trip:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -130,6 +305,7 @@ func CreateTrip() gin.HandlerFunc {
 			"message":     "Trip created successfully",
 			"tripID":      insertResult.InsertedID,
 			"invite_code": trip.Invite_Code,
+			"invite_link": helpers.InviteLink(*trip.Invite_Code),
 		})
 	}
 }
@@ -144,75 +320,39 @@ func GetAllTrip() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Parse pagination parameters
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-
-		startIndex := (page - 1) * recordPerPage
-
-		// Create aggregation pipeline
-		//its like a filter to make where
-		// here match means where
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}}}}
-
-		groupStage := bson.D{
-			{
-				Key: "$group",
-				Value: bson.D{
-					{Key: "_id", Value: "null"},
-					{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-					{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-				},
-			},
+		// Parse pagination parameters, recordPerPage is still understood as the page size
+		var page helpers.PageRequest
+		if err := c.ShouldBindQuery(&page); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query: " + err.Error()})
+			return
 		}
-		projectStage := bson.D{
-			{
-				Key: "$project",
-				Value: bson.D{
-					{Key: "_id", Value: 0},
-					{Key: "total_count", Value: 1},
-					{Key: "user_items", Value: bson.D{
-						{Key: "$slice", Value: bson.A{"$data", startIndex, recordPerPage}},
-					}},
-				},
-			},
+		if recordPerPage, err := strconv.Atoi(c.Query("recordPerPage")); err == nil && page.Limit == 0 {
+			page.Limit = recordPerPage
 		}
-
-		// Execute aggregation
-		result, err := tripCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users: " + err.Error()})
+		if err := helpers.ValidatePage(&page, helpers.TripPageSpec); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Decode results
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding results: " + err.Error()})
-			return
+		filter := helpers.TripFilter{
+			Status:          c.Query("status"),
+			Phase:           c.Query("phase"),
+			Destination:     c.Query("destination"),
+			Search:          c.Query("q"),
+			IncludeArchived: true,
 		}
 
-		if len(allUsers) == 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"total_count": 0,
-				"user_items":  []bson.M{},
-			})
+		tripItems, pageInfo, err := helpers.AggregatePage[bson.M](ctx, tripCollection, helpers.TripListPipeline(bson.M{}, filter, time.Now()), page, helpers.TripPageSpec)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching trips: " + err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, allUsers[0])
-
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": pageInfo.Total_Count,
+			"user_items":  tripItems,
+			"page":        pageInfo,
+		})
 	}
-
 }
 
 func GetAllMyTrip() gin.HandlerFunc {
@@ -228,15 +368,29 @@ func GetAllMyTrip() gin.HandlerFunc {
 
 		fmt.Println("GetAllMyTrip: User ID:", uid)
 
-		// Step 1: Get trips created by the user
-		var createdTrips []models.Trip
-		createdCursor, err := tripCollection.Find(ctx, bson.M{"creator_id": uid})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching created trips: " + err.Error()})
+		// Step 1: Read paging, sorting and filters from the query
+		var page helpers.PageRequest
+		if err := c.ShouldBindQuery(&page); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query: " + err.Error()})
 			return
 		}
-		if err = createdCursor.All(ctx, &createdTrips); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding created trips: " + err.Error()})
+		if err := helpers.ValidatePage(&page, helpers.TripPageSpec); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter := helpers.TripFilter{
+			Status:          c.Query("status"),
+			Phase:           c.Query("phase"),
+			Destination:     c.Query("destination"),
+			Search:          c.Query("q"),
+			IncludeArchived: c.Query("include_archived") == "true",
+		}
+		if filter.Phase != "" && filter.Phase != helpers.TripUpcoming && filter.Phase != helpers.TripOngoing && filter.Phase != helpers.TripPast {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "phase must be upcoming, ongoing or past"})
+			return
+		}
+		if filter.Status != "" && !helpers.ValidTripStatus(filter.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status: " + filter.Status})
 			return
 		}
 
@@ -260,30 +414,31 @@ func GetAllMyTrip() gin.HandlerFunc {
 			}
 		}
 
-		// Step 4: Fetch linked trips (exclude trips already created by the user)
-		var linkedTrips []models.Trip
-		if len(linkedTripIDs) > 0 {
-			filter := bson.M{
-				"trip_id":    bson.M{"$in": linkedTripIDs},
-				"creator_id": bson.M{"$ne": uid},
-			}
-			linkedCursor, err := tripCollection.Find(ctx, filter)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching linked trips: " + err.Error()})
-				return
-			}
-			if err = linkedCursor.All(ctx, &linkedTrips); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding linked trips: " + err.Error()})
+		// Step 4: Fetch one page of the trips the user created or is linked to
+		scope := bson.M{"$or": bson.A{
+			bson.M{"creator_id": uid},
+			bson.M{"trip_id": bson.M{"$in": linkedTripIDs}},
+		}}
+		now := time.Now()
+		allTrips, pageInfo, err := helpers.AggregatePage[models.Trip](ctx, tripCollection, helpers.TripListPipeline(scope, filter, now), page, helpers.TripPageSpec)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching trips: " + err.Error()})
+			return
+		}
+
+		// Step 5: Migrate and respond
+		for i := range allTrips {
+			if err := helpers.EnsureTripMembers(ctx, &allTrips[i]); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error migrating trip members: " + err.Error()})
 				return
 			}
+			allTrips[i].Phase = helpers.TripPhase(allTrips[i], now)
 		}
 
-		// Step 5: Combine and respond
-		allTrips := append(createdTrips, linkedTrips...)
-
 		c.JSON(http.StatusOK, gin.H{
-			"total_count": len(allTrips),
+			"total_count": pageInfo.Total_Count,
 			"trips":       allTrips,
+			"page":        pageInfo,
 		})
 	}
 }
@@ -302,58 +457,29 @@ func GetAllNotFreeMemberOnInviteCode() gin.HandlerFunc {
 			return
 		}
 
-		// Create match stage for aggregation
-		matchStage := bson.D{
-			{"$match", bson.D{
-				{"invite_code", requestBody.InviteCode},
-			}},
-		}
-
-		// Execute aggregation
-		cursor, err := tripCollection.Aggregate(ctx, mongo.Pipeline{matchStage})
+		trip, err := helpers.FindTrip(ctx, bson.M{"invite_code": helpers.ParseInviteCode(requestBody.InviteCode)})
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "No trip with this invite code " + err.Error()})
-			return
-		}
-
-		// Decode results
-		var results []bson.M
-		if err := cursor.All(ctx, &results); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		if len(results) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found with the given invite code"})
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found with the given invite code"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+			}
 			return
 		}
-
-		tripDoc := results[0]
-		rawMembers, ok := tripDoc["members"].(bson.A)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid members format"})
+		if err := helpers.ValidateInvite(trip); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
 			return
 		}
 
-		var members []string
-		for _, m := range rawMembers {
-			if name, ok := m.(string); ok {
-				members = append(members, name)
-			}
-		}
-
-		// Get trip ID
-		tripID := tripDoc["trip_id"].(string)
-
 		// Get free and non-free members
-		free, notFree := helpers.GetAllFreeMembers(tripID, members)
+		free, notFree := helpers.GetAllFreeMembers(trip)
 
 		c.JSON(http.StatusOK, gin.H{
-			"trip_id":          tripID,
-			"trip_name":        tripDoc["trip_name"],
+			"trip_id":          trip.Trip_ID,
+			"trip_name":        trip.Name,
 			"free_members":     free,
 			"not_free_members": notFree,
-			"total_members":    len(members),
+			"total_members":    len(*trip.Member_List),
 			"total_free":       len(free),
 			"total_not_free":   len(notFree),
 		})
@@ -368,7 +494,8 @@ func LinkMember() gin.HandlerFunc {
 		// Step 1: Bind request JSON
 		var requestBody struct {
 			InviteCode string `json:"invite_code" binding:"required"`
-			MemberName string `json:"name" binding:"required"`
+			MemberID   string `json:"member_id"`
+			MemberName string `json:"name"`
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
@@ -383,8 +510,7 @@ func LinkMember() gin.HandlerFunc {
 		}
 
 		// Step 3: Find trip by invite code
-		var trip models.Trip
-		err := tripCollection.FindOne(ctx, bson.M{"invite_code": requestBody.InviteCode}).Decode(&trip)
+		trip, err := helpers.FindTrip(ctx, bson.M{"invite_code": helpers.ParseInviteCode(requestBody.InviteCode)})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "No trip found with this invite code"})
@@ -393,72 +519,59 @@ func LinkMember() gin.HandlerFunc {
 			}
 			return
 		}
+		if err := helpers.ValidateInvite(trip); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
 
 		// Step 4: Check if member exists in trip members
-		memberExists := false
-		if trip.Members != nil {
-			for _, member := range *trip.Members {
-				if member == requestBody.MemberName {
-					memberExists = true
-					break
-				}
-			}
+		member := helpers.FindTripMember(trip, requestBody.MemberID)
+		if member == nil {
+			member = helpers.FindTripMember(trip, requestBody.MemberName)
 		}
-		if !memberExists {
+		if member == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Member not found in trip members"})
 			return
 		}
-
-		// Step 5: Check if member is already linked
-		var existingLink models.Member
-		err = linkedMemberCollection.FindOne(ctx, bson.M{
-			"trip_id": trip.Trip_ID,
-			"name":    requestBody.MemberName,
-		}).Decode(&existingLink)
-		if err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is already linked"})
-			return
-		} else if err != mongo.ErrNoDocuments {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking existing link: " + err.Error()})
+		if requestToJoin(ctx, c, trip, *member, uid) {
 			return
 		}
 
-		// Step 5.1: Check if member is linked with any username in this trip
-		var existingMemberLink models.Member
-		err = linkedMemberCollection.FindOne(ctx, bson.M{
-			"trip_id": trip.Trip_ID,
-			"uid":     uid,
-		}).Decode(&existingMemberLink)
-		if err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "You have already linked with another member in this trip"})
-			return
-		} else if err != mongo.ErrNoDocuments {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking existing member link: " + err.Error()})
+		// Step 5: Link the member unless it or the user is already linked
+		// The invite use is given back when the claim fails
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := helpers.ConsumeInvite(ctx, trip); err != nil {
+				return err
+			}
+			return helpers.ClaimTripMember(ctx, trip, *member, uid)
+		})
+		if err != nil {
+			switch err {
+			case helpers.ErrInviteUsedUp:
+				c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			case helpers.ErrMemberAlreadyLinked, helpers.ErrUserAlreadyLinked:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error linking member: " + err.Error()})
+			}
 			return
 		}
 
-		// Step 6: Create and insert new link
-		linkMember := models.Member{
-			ID:      primitive.NewObjectID(),
-			Trip_ID: trip.Trip_ID,
-			Name:    &requestBody.MemberName,
-			Uid:     &uid,
-		}
-		_, err = linkedMemberCollection.InsertOne(ctx, linkMember)
+		// Step 6: Return success with updated member status
+		trip, err = helpers.FindTrip(ctx, bson.M{"trip_id": trip.Trip_ID})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert linked member: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
 			return
 		}
-
-		// Step 7: Return success with updated member status
-		free, notFree := helpers.GetAllFreeMembers(*trip.Trip_ID, *trip.Members)
+		free, notFree := helpers.GetAllFreeMembers(trip)
 		c.JSON(http.StatusOK, gin.H{
 			"message":          "Member linked successfully",
 			"trip_id":          trip.Trip_ID,
 			"trip_name":        trip.Name,
+			"member_id":        member.Member_ID,
 			"free_members":     free,
 			"not_free_members": notFree,
-			"total_members":    len(*trip.Members),
+			"total_members":    len(*trip.Member_List),
 			"total_free":       len(free),
 			"total_not_free":   len(notFree),
 		})
@@ -472,19 +585,28 @@ func AutomaticLinkMember() gin.HandlerFunc {
 		// Step 1: Bind request JSON
 		var requestBody struct {
 			InviteCode string `json:"invite_code" binding:"required"`
-			MemberName string `json:"name" binding:"required"`
-			UserId     string `json:"uid" binding:"required"`
+			MemberID   string `json:"member_id"`
+			MemberName string `json:"name"`
+			UserId     string `json:"uid"`
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 			return
 		}
 
+		// Step 2: Callers link themselves, only trip admins may link someone else
+		callerUid := c.GetString("uid")
+		if callerUid == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
 		uid := requestBody.UserId
+		if uid == "" {
+			uid = callerUid
+		}
 
 		// Step 3: Find trip by invite code
-		var trip models.Trip
-		err := tripCollection.FindOne(ctx, bson.M{"invite_code": requestBody.InviteCode}).Decode(&trip)
+		trip, err := helpers.FindTrip(ctx, bson.M{"invite_code": helpers.ParseInviteCode(requestBody.InviteCode)})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "No trip found with this invite code"})
@@ -493,72 +615,63 @@ func AutomaticLinkMember() gin.HandlerFunc {
 			}
 			return
 		}
+		if err := helpers.ValidateInvite(trip); err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			return
+		}
+		if uid != callerUid && !helpers.IsTripAdmin(trip, callerUid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can link another user"})
+			return
+		}
 
 		// Step 4: Check if member exists in trip members
-		memberExists := false
-		if trip.Members != nil {
-			for _, member := range *trip.Members {
-				if member == requestBody.MemberName {
-					memberExists = true
-					break
-				}
-			}
+		member := helpers.FindTripMember(trip, requestBody.MemberID)
+		if member == nil {
+			member = helpers.FindTripMember(trip, requestBody.MemberName)
 		}
-		if !memberExists {
+		if member == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Member not found in trip members"})
 			return
 		}
-
-		// Step 5: Check if member is already linked
-		var existingLink models.Member
-		err = linkedMemberCollection.FindOne(ctx, bson.M{
-			"trip_id": trip.Trip_ID,
-			"name":    requestBody.MemberName,
-		}).Decode(&existingLink)
-		if err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Member is already linked"})
-			return
-		} else if err != mongo.ErrNoDocuments {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking existing link: " + err.Error()})
+		if requestToJoin(ctx, c, trip, *member, uid) {
 			return
 		}
 
-		// Step 5.1: Check if member is linked with any username in this trip
-		var existingMemberLink models.Member
-		err = linkedMemberCollection.FindOne(ctx, bson.M{
-			"trip_id": trip.Trip_ID,
-			"uid":     uid,
-		}).Decode(&existingMemberLink)
-		if err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "You have already linked with another member in this trip"})
-			return
-		} else if err != mongo.ErrNoDocuments {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking existing member link: " + err.Error()})
+		// Step 5: Link the member unless it or the user is already linked
+		// The invite use is given back when the claim fails
+		err = helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := helpers.ConsumeInvite(ctx, trip); err != nil {
+				return err
+			}
+			return helpers.ClaimTripMember(ctx, trip, *member, uid)
+		})
+		if err != nil {
+			switch err {
+			case helpers.ErrInviteUsedUp:
+				c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			case helpers.ErrMemberAlreadyLinked, helpers.ErrUserAlreadyLinked:
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error linking member: " + err.Error()})
+			}
 			return
 		}
 
-		// Step 6: Create and insert new link
-		linkMember := models.Member{
-			ID:      primitive.NewObjectID(),
-			Trip_ID: trip.Trip_ID,
-			Name:    &requestBody.MemberName,
-			Uid:     &uid,
-		}
-		_, err = linkedMemberCollection.InsertOne(ctx, linkMember)
+		// Step 6: Return success with updated member status
+		trip, err = helpers.FindTrip(ctx, bson.M{"trip_id": trip.Trip_ID})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert linked member: " + err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
 			return
 		}
-
-		// Step 7: Return success with updated member status
-		free, notFree := helpers.GetAllFreeMembers(*trip.Trip_ID, *trip.Members)
+		free, notFree := helpers.GetAllFreeMembers(trip)
 		c.JSON(http.StatusOK, gin.H{
 			"message":          "Member linked successfully",
 			"trip_id":          trip.Trip_ID,
 			"trip_name":        trip.Name,
+			"member_id":        member.Member_ID,
 			"free_members":     free,
 			"not_free_members": notFree,
-			"total_members":    len(*trip.Members),
+			"total_members":    len(*trip.Member_List),
 			"total_free":       len(free),
 			"total_not_free":   len(notFree),
 		})
@@ -578,14 +691,13 @@ func Pay() gin.HandlerFunc {
 		}
 
 		// Step 2: Validate required fields
-		if trans.Trip_ID == nil || trans.PayerName == nil || trans.ReciverName == nil || trans.Amount == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: trip_id, payer_name,amount and reciever_name are required"})
+		if trans.Trip_ID == nil || (trans.Payer_ID == nil && trans.PayerName == nil) || (trans.Reciver_ID == nil && trans.ReciverName == nil) || trans.Amount == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: trip_id, payer_id or payer_name, amount and reciever_id or reciever_name are required"})
 			return
 		}
 
 		// Step 3: Check if trip exists
-		var trip models.Trip
-		err := tripCollection.FindOne(ctx, bson.M{"trip_id": *trans.Trip_ID}).Decode(&trip)
+		trip, err := helpers.FindTrip(ctx, bson.M{"trip_id": *trans.Trip_ID})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
@@ -595,35 +707,43 @@ func Pay() gin.HandlerFunc {
 			return
 		}
 
+		if !requireTripAcceptsExpenses(c, trip) {
+			return
+		}
+
 		// Step 4: Check if payer and receiver are members of the trip
-		if trip.Members != nil {
-			payerFound := false
-			receiverFound := false
-			for _, member := range *trip.Members {
-				if member == *trans.PayerName {
-					payerFound = true
-				}
-				if member == *trans.ReciverName {
-					receiverFound = true
-				}
-			}
-			if !payerFound || !receiverFound {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Payer or receiver is not a member of this trip"})
-				return
-			}
+		if !resolveTransactionMembers(trip, &trans) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payer or receiver is not a member of this trip"})
+			return
 		}
 
 		// Step 5: Create transaction record
 		trans.ID = primitive.NewObjectID()
 		trans.Created_At = time.Now()
+		trans.Version = 1
 		Type := "Paid"
 		trans.Type = &Type
 		isDeleted := false
 		trans.IsDeleted = &isDeleted
+		// Attachments are added through their own upload endpoint and only
+		// the recurring job creates occurrences
+		trans.Attachments = nil
+		trans.Deleted_At = nil
+		trans.Recurring_ID = nil
+		trans.Occurrence_At = nil
+		trans.Occurrence_Key = nil
 		if trans.Description == nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Can;t have payment without description"})
 			return
 		}
+		if trans.Category != nil {
+			category := helpers.NormalizeCategory(*trans.Category)
+			if !helpers.ValidCategory(trip, category) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category: " + *trans.Category})
+				return
+			}
+			trans.Category = &category
+		}
 
 		resultNumber, err := transactionCollection.InsertOne(ctx, trans)
 		if err != nil {
@@ -631,6 +751,11 @@ func Pay() gin.HandlerFunc {
 			return
 		}
 
+		// Step 6: Let the trip know when this expense broke a budget
+		if err := helpers.CheckBudgets(ctx, trip, trans, c.GetString("uid")); err != nil {
+			fmt.Println("Error checking budgets:", err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"message":        "Transaction recorded successfully",
 			"transaction_id": resultNumber.InsertedID,
@@ -651,14 +776,13 @@ func Settle() gin.HandlerFunc {
 		}
 
 		// Step 2: Validate required fields
-		if trans.Trip_ID == nil || trans.PayerName == nil || trans.ReciverName == nil || trans.Amount == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: trip_id, payer_name,amount and reciever_name are required"})
+		if trans.Trip_ID == nil || (trans.Payer_ID == nil && trans.PayerName == nil) || (trans.Reciver_ID == nil && trans.ReciverName == nil) || trans.Amount == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required fields: trip_id, payer_id or payer_name, amount and reciever_id or reciever_name are required"})
 			return
 		}
 
 		// Step 3: Check if trip exists
-		var trip models.Trip
-		err := tripCollection.FindOne(ctx, bson.M{"trip_id": *trans.Trip_ID}).Decode(&trip)
+		trip, err := helpers.FindTrip(ctx, bson.M{"trip_id": *trans.Trip_ID})
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Trip not found"})
@@ -668,31 +792,33 @@ func Settle() gin.HandlerFunc {
 			return
 		}
 
+		// Closed trips still take settlements, only archived ones are frozen
+		if !requireTripWritable(c, trip) {
+			return
+		}
+
 		// Step 4: Check if payer and receiver are members of the trip
-		if trip.Members != nil {
-			payerFound := false
-			receiverFound := false
-			for _, member := range *trip.Members {
-				if member == *trans.PayerName {
-					payerFound = true
-				}
-				if member == *trans.ReciverName {
-					receiverFound = true
-				}
-			}
-			if !payerFound || !receiverFound {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Payer or receiver is not a member of this trip"})
-				return
-			}
+		if !resolveTransactionMembers(trip, &trans) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Payer or receiver is not a member of this trip"})
+			return
 		}
 
 		// Step 5: Create transaction record
 		trans.ID = primitive.NewObjectID()
 		trans.Created_At = time.Now()
+		trans.Version = 1
 		Type := "Settle"
 		trans.Type = &Type
+		trans.Category = nil
 		isDeleted := false
 		trans.IsDeleted = &isDeleted
+		// Attachments are added through their own upload endpoint and only
+		// the recurring job creates occurrences
+		trans.Attachments = nil
+		trans.Deleted_At = nil
+		trans.Recurring_ID = nil
+		trans.Occurrence_At = nil
+		trans.Occurrence_Key = nil
 		// if trans.Description==nil{
 		// 	c.JSON(http.StatusBadRequest,gin.H{"error":"Can;t have payment without description"})
 		// 	return
@@ -719,44 +845,104 @@ func GetAllTransaction() gin.HandlerFunc {
 
 		// Step 1: Bind request JSON
 		var requestBody struct {
-			TripId string `json:"trip_id" binding:"required"`
+			helpers.PageRequest
+			TripId     string   `json:"trip_id" binding:"required"`
+			PayerID    string   `json:"payer_id"`
+			ReceiverID string   `json:"reciever_id"`
+			Type       string   `json:"type"`
+			Category   string   `json:"category"`
+			From       string   `json:"from"`
+			To         string   `json:"to"`
+			Timezone   string   `json:"timezone"`
+			MinAmount  *float64 `json:"min_amount"`
+			MaxAmount  *float64 `json:"max_amount"`
+			Search     string   `json:"q"`
+			Deleted    string   `json:"deleted"`
 		}
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 			return
 		}
-
-		// Step 2: Get user ID from context
-		uid := c.GetString("uid")
-		if uid == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		if err := helpers.ValidatePage(&requestBody.PageRequest, helpers.TransactionPageSpec); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		// Create match stage to filter by trip_id and exclude deleted transactions
-		matchStage := bson.D{
-			{"$match", bson.D{
-				{"trip_id", requestBody.TripId},
-			}},
+		// Step 2: Check the caller belongs to the trip
+		trip, _, ok := loadTripForMember(ctx, c, requestBody.TripId)
+		if !ok {
+			return
 		}
 
-		// Execute aggregation to get all transactions
-		result, err := transactionCollection.Aggregate(ctx, mongo.Pipeline{matchStage})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+		// Step 3: Turn the request into a filter
+		filter := helpers.TransactionFilter{
+			TripID:    requestBody.TripId,
+			Type:      requestBody.Type,
+			MinAmount: requestBody.MinAmount,
+			MaxAmount: requestBody.MaxAmount,
+			Search:    requestBody.Search,
+			Deleted:   requestBody.Deleted,
+		}
+		// Deleted transactions have always been part of this listing
+		if filter.Deleted == "" {
+			filter.Deleted = helpers.DeletedInclude
+		}
+		if filter.Deleted != helpers.DeletedInclude && filter.Deleted != helpers.DeletedExclude && filter.Deleted != helpers.DeletedOnly {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "deleted must be include, exclude or only"})
+			return
+		}
+		if filter.Type != "" && filter.Type != "Paid" && filter.Type != "Settle" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be Paid or Settle"})
+			return
+		}
+		if requestBody.PayerID != "" {
+			if filter.Payer = helpers.FindTripMember(trip, requestBody.PayerID); filter.Payer == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Payer is not a member of this trip"})
+				return
+			}
+		}
+		if requestBody.ReceiverID != "" {
+			if filter.Receiver = helpers.FindTripMember(trip, requestBody.ReceiverID); filter.Receiver == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Receiver is not a member of this trip"})
+				return
+			}
+		}
+		if requestBody.Category != "" {
+			filter.Category = helpers.NormalizeCategory(requestBody.Category)
+		}
+		location := helpers.TripLocation(trip)
+		if requestBody.Timezone != "" {
+			loc, err := time.LoadLocation(requestBody.Timezone)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + requestBody.Timezone})
+				return
+			}
+			location = loc
+		}
+		if filter.From, ok = parseDateBound(requestBody.From, location, false); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		if filter.To, ok = parseDateBound(requestBody.To, location, true); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_amount can't be more than max_amount"})
 			return
 		}
 
-		// Decode results
-		var transactions []bson.M
-		if err = result.All(ctx, &transactions); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding results: " + err.Error()})
+		// Step 4: Fetch one page
+		transactions, pageInfo, err := helpers.AggregatePage[bson.M](ctx, transactionCollection, helpers.TransactionListPipeline(filter), requestBody.PageRequest, helpers.TransactionPageSpec)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"total_count":  len(transactions),
+			"total_count":  pageInfo.Total_Count,
 			"transactions": transactions,
+			"page":         pageInfo,
 		})
 	}
 }
@@ -775,6 +961,13 @@ func GetSettlements() gin.HandlerFunc {
 			return
 		}
 
+		// Trips recorded before member ids existed are migrated first, so old
+		// and new transactions are keyed the same way
+		if _, err := helpers.FindTrip(ctx, bson.M{"trip_id": requestBody.TripId}); err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+			return
+		}
+
 		// Step 2: Get all transactions for the trip (excluding deleted ones)
 		matchStage := bson.D{
 			{"$match", bson.D{
@@ -846,6 +1039,7 @@ func GetCasualNameByUID() gin.HandlerFunc {
 
 		c.JSON(http.StatusOK, gin.H{
 			"casual_name": member.Name,
+			"member_id":   member.Member_ID,
 		})
 	}
 }
@@ -865,8 +1059,13 @@ func GetContactInfo() gin.HandlerFunc {
 			return
 		}
 
+		if limit := helpers.MaxContactsPerRequest(); len(req.Contacts) > limit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Too many contacts, send at most " + strconv.Itoa(limit) + " per request"})
+			return
+		}
+
 		// Process the contact list
-		enrichedContacts, err := helpers.GetContactInfoHelper(req.Contacts)
+		enrichedContacts, err := helpers.GetContactInfoHelper(req.Contacts, req.Region, req.Hashed)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process contacts: " + err.Error()})
 			return
@@ -917,6 +1116,10 @@ func DeleteTrip() gin.HandlerFunc {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator can delete this trip"})
 			return
 		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
 
 		// Soft delete: update is_deleted field to true
 		update := bson.M{
@@ -925,11 +1128,15 @@ func DeleteTrip() gin.HandlerFunc {
 			},
 		}
 
-		_, err = tripCollection.UpdateOne(ctx, filter, update)
+		result, err := tripCollection.UpdateOne(ctx, helpers.WithVersion(filter, expected), helpers.BumpVersion(update))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete trip"})
 			return
 		}
+		if result.MatchedCount == 0 {
+			rejectStaleTrip(ctx, c, request.Trip_ID)
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Trip deleted successfully"})
 	}
@@ -1004,23 +1211,88 @@ func DeleteTransaction() gin.HandlerFunc {
 		fmt.Printf("Found transaction: %+v\n", txn)
 
 		// 👮 Check if the current user is the payer
-		if txn.PayerName == nil || *txn.PayerName != *member.Name {
+		if !isTransactionPayer(txn, member) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You are not the payer of this transaction"})
 			return
 		}
 
+		trip, err := helpers.FindTrip(ctx, bson.M{"trip_id": request.TripID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+			return
+		}
+		if txn.Type != nil && *txn.Type == "Settle" {
+			if !requireTripWritable(c, trip) {
+				return
+			}
+		} else if !requireTripAcceptsExpenses(c, trip) {
+			return
+		}
+		expected, ok := requireTransactionVersion(c, txn)
+		if !ok {
+			return
+		}
+
 		// 🗑️ Soft delete: set is_deleted = true
 		fmt.Printf("Updating transaction with filter: %+v\n", findFilter)
-		result, err := transactionCollection.UpdateOne(ctx, findFilter, bson.M{
-			"$set": bson.M{"is_deleted": true},
-		})
+		result, err := transactionCollection.UpdateOne(ctx, helpers.WithVersion(findFilter, expected), helpers.BumpVersion(bson.M{
+			"$set": bson.M{"is_deleted": true, "deleted_at": time.Now()},
+		}))
 		if err != nil {
 			fmt.Printf("Error updating transaction: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete transaction"})
 			return
 		}
 		fmt.Printf("Update result: %+v\n", result)
+		if result.MatchedCount == 0 {
+			rejectStaleTransaction(ctx, c, txnID)
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Transaction deleted successfully"})
 	}
 }
+
+// GetTransaction returns a single live transaction to a trip member, with its
+// version as the ETag and 304 for an If-None-Match that is still current
+func GetTransaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		_, _, txn, ok := loadTransactionForMember(ctx, c, c.Query("trip_id"), c.Query("transaction_id"))
+		if !ok {
+			return
+		}
+		respondVersioned(c, txn.Version, gin.H{"transaction": txn})
+	}
+}
+
+// resolveTransactionMembers matches the payer and receiver of a transaction to
+// trip members, by member id or by name, and fills in both
+func resolveTransactionMembers(trip models.Trip, trans *models.Transaction) bool {
+	resolve := func(memberID, name *string) *models.TripMember {
+		if memberID != nil {
+			return helpers.FindTripMember(trip, *memberID)
+		}
+		return helpers.FindTripMember(trip, *name)
+	}
+
+	payer := resolve(trans.Payer_ID, trans.PayerName)
+	receiver := resolve(trans.Reciver_ID, trans.ReciverName)
+	if payer == nil || receiver == nil {
+		return false
+	}
+
+	trans.Payer_ID, trans.PayerName = payer.Member_ID, payer.Display_Name
+	trans.Reciver_ID, trans.ReciverName = receiver.Member_ID, receiver.Display_Name
+	return true
+}
+
+// isTransactionPayer tells whether the linked member paid the transaction
+func isTransactionPayer(txn models.Transaction, member models.Member) bool {
+	if txn.Payer_ID != nil && member.Member_ID != nil {
+		return *txn.Payer_ID == *member.Member_ID
+	}
+	return txn.PayerName != nil && member.Name != nil && *txn.PayerName == *member.Name
+}
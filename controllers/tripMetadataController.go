@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetTrip returns a single trip to a member, with its version as the ETag.
+// A client that sends the ETag it has in If-None-Match gets 304 while the
+// trip is unchanged.
+func GetTrip() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		trip, _, ok := loadTripForMember(ctx, c, c.Query("trip_id"))
+		if !ok {
+			return
+		}
+		trip.Phase = helpers.TripPhase(trip, time.Now())
+		respondVersioned(c, trip.Version, gin.H{"trip": trip})
+	}
+}
+
+// UpdateTrip lets trip admins edit the name, description, dates, destination
+// and timezone of a trip. Fields left out are kept, fields listed in clear are removed.
+func UpdateTrip() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID      string   `json:"trip_id" binding:"required"`
+			Name        *string  `json:"trip_name"`
+			Description *string  `json:"description"`
+			StartDate   *string  `json:"start_date"`
+			EndDate     *string  `json:"end_date"`
+			Destination *string  `json:"destination"`
+			Timezone    *string  `json:"timezone"`
+			Clear       []string `json:"clear"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can edit the trip"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		set := bson.M{}
+		unset := bson.M{}
+		for _, field := range request.Clear {
+			switch field {
+			case "description", "start_date", "end_date", "destination", "timezone":
+				unset[field] = ""
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Field can't be cleared: " + field})
+				return
+			}
+		}
+
+		if request.Name != nil {
+			name := strings.TrimSpace(*request.Name)
+			if name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Trip name cannot be empty"})
+				return
+			}
+			set["name"] = name
+		}
+		if request.Description != nil {
+			set["description"] = strings.TrimSpace(*request.Description)
+		}
+		if request.Destination != nil {
+			destination := strings.TrimSpace(*request.Destination)
+			if destination == "" {
+				unset["destination"] = ""
+			} else {
+				set["destination"] = destination
+			}
+		}
+
+		// Dates are days in the trip's timezone, so a new timezone moves the
+		// stored dates along with it
+		oldLocation := helpers.TripLocation(trip)
+		location := oldLocation
+		if request.Timezone != nil {
+			loc, err := time.LoadLocation(*request.Timezone)
+			if err != nil || *request.Timezone == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + *request.Timezone})
+				return
+			}
+			location = loc
+			set["timezone"] = *request.Timezone
+		} else if _, cleared := unset["timezone"]; cleared {
+			location = time.UTC
+		}
+
+		dates := map[string]*time.Time{"start_date": trip.Start_Date, "end_date": trip.End_Date}
+		for field, value := range map[string]*string{"start_date": request.StartDate, "end_date": request.EndDate} {
+			if _, cleared := unset[field]; cleared {
+				dates[field] = nil
+				continue
+			}
+			if value != nil {
+				day, err := helpers.ParseTripDate(*value, location)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field + ": " + err.Error()})
+					return
+				}
+				dates[field] = &day
+				set[field] = day
+			} else if dates[field] != nil && location != oldLocation {
+				day := helpers.StartOfTripDay(*dates[field], oldLocation)
+				day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+				dates[field] = &day
+				set[field] = day
+			}
+		}
+		if dates["start_date"] != nil && dates["end_date"] != nil && dates["end_date"].Before(*dates["start_date"]) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date can't be before start_date"})
+			return
+		}
+
+		if len(set) == 0 && len(unset) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		changed := make([]string, 0, len(set)+len(unset))
+		for field := range set {
+			changed = append(changed, field)
+		}
+		for field := range unset {
+			changed = append(changed, field)
+		}
+		err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			result, err := tripCollection.UpdateOne(ctx, helpers.WithVersion(bson.M{"trip_id": request.TripID}, expected), helpers.BumpVersion(update))
+			if err != nil {
+				return err
+			}
+			if result.MatchedCount == 0 {
+				return helpers.ErrStaleVersion
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "TRIP_UPDATED", uid, "", map[string]interface{}{
+				"fields": changed,
+			})
+		})
+		if err == helpers.ErrStaleVersion {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trip: " + err.Error()})
+			return
+		}
+
+		updated, err := helpers.FindTrip(ctx, bson.M{"trip_id": request.TripID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+			return
+		}
+		updated.Phase = helpers.TripPhase(updated, time.Now())
+		c.Header("ETag", helpers.ETag(updated.Version))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Trip updated successfully",
+			"trip":    updated,
+		})
+	}
+}
+
+// UploadTripCover sets the cover image of a trip.
+// Expects a multipart form with trip_id and file.
+func UploadTripCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		maxBytes := helpers.MaxAttachmentBytes()
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+64*1024)
+
+		tripID := c.PostForm("trip_id")
+		if tripID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "trip_id is required"})
+			return
+		}
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required (max " + strconv.FormatInt(maxBytes, 10) + " bytes): " + err.Error()})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, tripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can change the cover image"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read file: " + err.Error()})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read file: " + err.Error()})
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Cover image is larger than " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+		contentType := http.DetectContentType(data)
+		if !helpers.CoverImageTypes[contentType] {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Cover image must be a JPEG, PNG or WebP image"})
+			return
+		}
+
+		cover, err := helpers.SaveTripCover(ctx, trip, filepath.Base(fileHeader.Filename), contentType, data, uid, expected)
+		if err == helpers.ErrStaleVersion {
+			rejectStaleTrip(ctx, c, tripID)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cover image: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":     "Cover image uploaded successfully",
+			"cover_image": cover,
+		})
+	}
+}
+
+// GetTripCover streams the cover image of a trip back to a member
+func GetTripCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		trip, _, ok := loadTripForMember(ctx, c, c.Query("trip_id"))
+		if !ok {
+			return
+		}
+		if trip.Cover_Image == nil || trip.Cover_Image.Key == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip has no cover image"})
+			return
+		}
+
+		store, err := helpers.Blobs()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		reader, err := store.Get(ctx, *trip.Cover_Image.Key)
+		if err == helpers.ErrBlobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cover image file is missing"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read cover image: " + err.Error()})
+			return
+		}
+		defer reader.Close()
+
+		c.DataFromReader(http.StatusOK, trip.Cover_Image.Size, *trip.Cover_Image.Content_Type, reader, map[string]string{
+			"Content-Disposition": "inline; filename=\"" + unsafeAttachmentName.ReplaceAllString(*trip.Cover_Image.Filename, "_") + "\"",
+		})
+	}
+}
+
+// DeleteTripCover removes the cover image of a trip
+func DeleteTripCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !requireTripWritable(c, trip) {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can change the cover image"})
+			return
+		}
+		expected, ok := requireTripVersion(c, trip)
+		if !ok {
+			return
+		}
+		if trip.Cover_Image == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Trip has no cover image"})
+			return
+		}
+
+		err := helpers.DeleteTripCover(ctx, trip, expected)
+		if err == helpers.ErrStaleVersion {
+			rejectStaleTrip(ctx, c, request.TripID)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cover image: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Cover image deleted successfully"})
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireTripWritable answers with an error when the trip is archived
+func requireTripWritable(c *gin.Context, trip models.Trip) bool {
+	if err := helpers.CheckTripWritable(trip); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": helpers.TripStatus(trip)})
+		return false
+	}
+	return true
+}
+
+// requireTripAcceptsExpenses answers with an error when the trip no longer takes expenses
+func requireTripAcceptsExpenses(c *gin.Context, trip models.Trip) bool {
+	if err := helpers.CheckTripAcceptsExpenses(trip); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": helpers.TripStatus(trip)})
+		return false
+	}
+	return true
+}
+
+// SetTripStatus moves a trip through its lifecycle.
+// Closing a trip with unsettled balances is refused unless force is set.
+func SetTripStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			TripID string `json:"trip_id" binding:"required"`
+			Status string `json:"status" binding:"required"`
+			Force  bool   `json:"force"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+		if !helpers.ValidTripStatus(request.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be one of planning, active, settling, closed or archived"})
+			return
+		}
+
+		uid := c.GetString("uid")
+		trip, _, ok := loadTripForMember(ctx, c, request.TripID)
+		if !ok {
+			return
+		}
+		if !helpers.IsTripAdmin(trip, uid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only a trip admin can change the trip status"})
+			return
+		}
+		if _, ok := requireTripVersion(c, trip); !ok {
+			return
+		}
+
+		current := helpers.TripStatus(trip)
+		if !helpers.CanTransitionTrip(current, request.Status) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A " + current + " trip can't be moved to " + request.Status})
+			return
+		}
+
+		var finalBalances []models.FinalBalance
+		var unsettled []helpers.Settlement
+		if request.Status == helpers.TripClosed && current != helpers.TripArchived {
+			transactions, err := helpers.TripTransactions(ctx, request.TripID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching transactions: " + err.Error()})
+				return
+			}
+			unsettled = helpers.CalculateSettlements(transactions)
+			if len(unsettled) > 0 && !request.Force {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":       "The trip still has unsettled balances, settle them first or close with force",
+					"settlements": unsettled,
+				})
+				return
+			}
+			finalBalances = helpers.FinalBalances(trip, transactions)
+		}
+
+		err := helpers.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := helpers.SetTripStatus(ctx, trip, request.Status, finalBalances); err != nil {
+				return err
+			}
+			return helpers.RecordTripEvent(ctx, request.TripID, "TRIP_STATUS_CHANGED", uid, "", map[string]interface{}{
+				"from":      current,
+				"to":        request.Status,
+				"unsettled": len(unsettled),
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trip status: " + err.Error()})
+			return
+		}
+
+		response := gin.H{
+			"message": "Trip status updated successfully",
+			"status":  request.Status,
+		}
+		if finalBalances != nil {
+			response["final_balances"] = finalBalances
+		}
+		if len(unsettled) > 0 {
+			response["warning"] = "The trip was closed with unsettled balances"
+			response["settlements"] = unsettled
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"math/rand"
 	"strconv"
+	"strings"
 
 	// "fmt"
 	"log"
@@ -86,6 +87,11 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		if deletionIsDue(ctx, foundUser) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
 		// here in user we have a verify password
 		passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
 		if !passwordIsValid {
@@ -105,12 +111,7 @@ func Login() gin.HandlerFunc {
 			return
 		}
 		// the response you will receive after succefull login
-		c.JSON(http.StatusOK, gin.H{
-			"message":       "Login successful",
-			"user":          foundUser,
-			"token":         token,
-			"refresh_token": refreshToken,
-		})
+		c.JSON(http.StatusOK, authResponse("Login successful", foundUser, token, refreshToken))
 	}
 }
 func Signup() gin.HandlerFunc {
@@ -147,8 +148,17 @@ func Signup() gin.HandlerFunc {
 		password := HashPassword(*user.Password)
 		user.Password = &password
 
+		// Store the phone in E.164 so contacts can find the user however they saved the number
+		if !helpers.SetUserPhone(&user, helpers.DefaultPhoneRegion()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number"})
+			return
+		}
+
 		// Check if phone exists
-		count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
+		count, err = userCollection.CountDocuments(ctx, bson.M{"$or": bson.A{
+			bson.M{"phone": user.Phone},
+			bson.M{"phone_e164": user.Phone_E164},
+		}})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error while checking phone: " + err.Error()})
 			return
@@ -161,6 +171,9 @@ func Signup() gin.HandlerFunc {
 
 		// Set user metadata
 		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		user.Deletion_Requested_At = nil
+		user.Deletion_Scheduled_At = nil
+		user.IsDeleted = nil
 
 		//get a new object as id
 		user.ID = primitive.NewObjectID()
@@ -175,6 +188,16 @@ func Signup() gin.HandlerFunc {
 
 		// Insert user it give back a insertion no just plane syntax
 		resultInsertionNumber, inserterr := userCollection.InsertOne(ctx, user)
+		// The checks above can race with a concurrent signup; the unique
+		// indexes on email and phone have the final say
+		if mongo.IsDuplicateKeyError(inserterr) {
+			message := "This email is already registered"
+			if strings.Contains(inserterr.Error(), "phone") {
+				message = "This phone number is already registered"
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": message})
+			return
+		}
 		if inserterr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user: " + inserterr.Error()})
 			return
@@ -200,72 +223,31 @@ func GetUsers() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		// Parse pagination parameters
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-
-		page, err := strconv.Atoi(c.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-
-		startIndex := (page - 1) * recordPerPage
-
-		// Create aggregation pipeline
-		//its like a filter to make where
-		// here match means where
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}}}}
-
-		groupStage := bson.D{
-			{
-				Key: "$group",
-				Value: bson.D{
-					{Key: "_id", Value: "null"},
-					{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
-					{Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
-				},
-			},
-		}
-		projectStage := bson.D{
-			{
-				Key: "$project",
-				Value: bson.D{
-					{Key: "_id", Value: 0},
-					{Key: "total_count", Value: 1},
-					{Key: "user_items", Value: bson.D{
-						{Key: "$slice", Value: bson.A{"$data", startIndex, recordPerPage}},
-					}},
-				},
-			},
-		}
-
-		// Execute aggregation
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users: " + err.Error()})
+		// Parse pagination parameters, recordPerPage is still understood as the page size
+		var page helpers.PageRequest
+		if err := c.ShouldBindQuery(&page); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query: " + err.Error()})
 			return
 		}
-
-		// Decode results
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding results: " + err.Error()})
+		if recordPerPage, err := strconv.Atoi(c.Query("recordPerPage")); err == nil && page.Limit == 0 {
+			page.Limit = recordPerPage
+		}
+		if err := helpers.ValidatePage(&page, helpers.UserPageSpec); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		if len(allUsers) == 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"total_count": 0,
-				"user_items":  []bson.M{},
-			})
+		users, pageInfo, err := helpers.AggregatePage[models.User](ctx, userCollection, helpers.UserListPipeline(c.Query("user_type"), c.Query("q")), page, helpers.UserPageSpec)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users: " + err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, allUsers[0])
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": pageInfo.Total_Count,
+			"user_items":  adminUserItems(users),
+			"page":        pageInfo,
+		})
 	}
 }
 func GetUser() gin.HandlerFunc {
@@ -285,9 +267,15 @@ func GetUser() gin.HandlerFunc {
 		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
 		defer cancel()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error})
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
 		}
-		c.JSON(http.StatusOK, user)
+
+		c.JSON(http.StatusOK, userView(user, c.GetString("uid")))
 
 	}
 
@@ -429,6 +417,11 @@ func VerifyOTP() gin.HandlerFunc {
 			return
 		}
 
+		if deletionIsDue(ctx, foundUser) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found with this email"})
+			return
+		}
+
 		// Generate tokens
 		token, refreshToken := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_Name, *foundUser.Last_Name, *foundUser.User_type, *foundUser.User_id)
 
@@ -443,11 +436,47 @@ func VerifyOTP() gin.HandlerFunc {
 		}
 
 		// Return success response with tokens (same as login)
-		c.JSON(http.StatusOK, gin.H{
-			"message":       "OTP verified successfully",
-			"user":          foundUser,
-			"token":         token,
-			"refresh_token": refreshToken,
-		})
+		c.JSON(http.StatusOK, authResponse("OTP verified successfully", foundUser, token, refreshToken))
+	}
+}
+
+// authResponse is what a successful login hands back. The tokens are the ones
+// just issued, the user view carries none of the stored secrets.
+func authResponse(message string, user models.User, token, refreshToken string) gin.H {
+	return gin.H{
+		"message":       message,
+		"user":          user.Self(),
+		"token":         token,
+		"refresh_token": refreshToken,
+	}
+}
+
+// userView is a user as the caller gets to see them, their own profile or the admin view
+func userView(user models.User, callerUid string) interface{} {
+	if user.User_id != nil && *user.User_id == callerUid {
+		return user.Self()
+	}
+	return user.Admin()
+}
+
+// adminUserItems turns user documents into the admin view, never the raw
+// documents with hashes and tokens
+func adminUserItems(users []models.User) []models.AdminUser {
+	items := make([]models.AdminUser, 0, len(users))
+	for _, user := range users {
+		items = append(items, user.Admin())
+	}
+	return items
+}
+
+// deletionIsDue finalizes an account whose deletion grace period has run out,
+// so a late login can't revive it
+func deletionIsDue(ctx context.Context, user models.User) bool {
+	if user.Deletion_Scheduled_At == nil || user.User_id == nil || time.Now().Before(*user.Deletion_Scheduled_At) {
+		return false
+	}
+	if err := helpers.FinalizeAccountDeletion(ctx, *user.User_id); err != nil {
+		log.Printf("Error finalizing account deletion for %s: %v", *user.User_id, err)
 	}
+	return true
 }
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userRouter serves the user endpoints with the caller the token would name
+func userRouter(uid, userType string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	caller := func(c *gin.Context) {
+		c.Set("uid", uid)
+		c.Set("user_type", userType)
+	}
+	r.POST("/auth/login", Login())
+	r.POST("/auth/verifyotp", VerifyOTP())
+	r.GET("/users", caller, GetUsers())
+	r.GET("/users/:user_id", caller, GetUser())
+	return r
+}
+
+func assertNoSecrets(t *testing.T, w *httptest.ResponseRecorder, allowedTopLevel ...string) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	found, err := models.FindUserSecrets(w.Body.Bytes(), allowedTopLevel...)
+	if err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	for _, where := range found {
+		t.Errorf("secret at %s", where)
+	}
+}
+
+func TestUserResponsesCarryNoSecrets(t *testing.T) {
+	if !database.IntegrationEnabled() {
+		t.Skip("set MONGODB_INTEGRATION=true with a reachable MongoDB to run")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	uid := "test-" + primitive.NewObjectID().Hex()
+	user := models.UserWithSecrets(uid)
+	password := HashPassword("correct horse")
+	user.Password = &password
+	otp := models.OTP{ID: primitive.NewObjectID(), Email: *user.Email, OTP: "123456", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+	if _, err := userCollection.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otpCollection.InsertOne(ctx, otp); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		userCollection.DeleteOne(ctx, bson.M{"user_id": uid})
+		otpCollection.DeleteMany(ctx, bson.M{"email": *user.Email})
+	})
+
+	// A login hands out the tokens it just issued, nothing that was stored
+	t.Run("login", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := `{"email":"` + *user.Email + `","password":"correct horse"}`
+		userRouter("", "").ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body)))
+		assertNoSecrets(t, w, "token", "refresh_token")
+	})
+	t.Run("verify otp", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := `{"email":"` + *user.Email + `","otp":"123456"}`
+		userRouter("", "").ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/verifyotp", strings.NewReader(body)))
+		assertNoSecrets(t, w, "token", "refresh_token")
+	})
+	t.Run("get own user", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		userRouter(uid, "USER").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+uid, nil))
+		assertNoSecrets(t, w)
+	})
+	t.Run("get user as admin", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		userRouter("admin-1", "ADMIN").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+uid, nil))
+		assertNoSecrets(t, w)
+	})
+	t.Run("get users", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		userRouter("admin-1", "ADMIN").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?q="+uid, nil))
+		assertNoSecrets(t, w)
+		if !strings.Contains(w.Body.String(), uid) {
+			t.Errorf("the user is missing from %s", w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"connection/helpers"
+	"connection/models"
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ifMatchVersion reads the version the If-Match header of a write expects,
+// nil when the client didn't send one
+func ifMatchVersion(c *gin.Context) (*int64, bool) {
+	version, err := helpers.ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return version, true
+}
+
+// rejectStaleVersion answers a write made against an old version with the
+// version the document is at now
+func rejectStaleVersion(c *gin.Context, current int64) {
+	c.Header("ETag", helpers.ETag(current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   helpers.ErrStaleVersion.Error(),
+		"version": current,
+	})
+}
+
+// requireTripVersion checks the If-Match header against the trip as loaded.
+// The expected version it returns goes into the filter of the write, so a
+// change that slips in between is caught as well.
+func requireTripVersion(c *gin.Context, trip models.Trip) (*int64, bool) {
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return nil, false
+	}
+	if expected != nil && *expected != trip.Version {
+		rejectStaleVersion(c, trip.Version)
+		return nil, false
+	}
+	return expected, true
+}
+
+// requireTransactionVersion checks the If-Match header against a transaction as loaded
+func requireTransactionVersion(c *gin.Context, transaction models.Transaction) (*int64, bool) {
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return nil, false
+	}
+	if expected != nil && *expected != transaction.Version {
+		rejectStaleVersion(c, transaction.Version)
+		return nil, false
+	}
+	return expected, true
+}
+
+// rejectStaleTrip answers a conditional trip write that matched nothing
+func rejectStaleTrip(ctx context.Context, c *gin.Context, tripID string) {
+	var trip models.Trip
+	if err := tripCollection.FindOne(ctx, bson.M{"trip_id": tripID}).Decode(&trip); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding trip: " + err.Error()})
+		return
+	}
+	rejectStaleVersion(c, trip.Version)
+}
+
+// rejectStaleTransaction answers a conditional transaction write that matched nothing
+func rejectStaleTransaction(ctx context.Context, c *gin.Context, id primitive.ObjectID) {
+	var transaction models.Transaction
+	if err := transactionCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&transaction); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding transaction: " + err.Error()})
+		return
+	}
+	rejectStaleVersion(c, transaction.Version)
+}
+
+// respondVersioned sends a single trip or transaction with its ETag, or 304
+// when the client's copy named in If-None-Match is still current
+func respondVersioned(c *gin.Context, version int64, body gin.H) {
+	c.Header("ETag", helpers.ETag(version))
+	if match := c.GetHeader("If-None-Match"); match != "" && helpers.MatchesVersion(match, version) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -6,6 +6,7 @@ import (
 	// "fmt"
 	"log"
 	"os"
+	"testing"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -23,6 +24,9 @@ func init() {
 	}
 
 	uri := os.Getenv("MONGODB_URI")
+	if uri == "" && testing.Testing() {
+		uri = "mongodb://localhost:27017"
+	}
 	// if uri == "" {
 	// 	log.Fatal("❌ MONGODB_URI not set")
 	// }
@@ -38,13 +42,31 @@ func init() {
 
 	// Ping to ensure connection
 	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("❌ MongoDB ping failed: %v", err)
+		// Unit tests run without a database, the ones that need one skip
+		if !testing.Testing() {
+			log.Fatalf("❌ MongoDB ping failed: %v", err)
+		}
+		log.Printf("⚠️ MongoDB not reachable, tests that need it are skipped: %v", err)
 	}
 
 	Client = client
 	log.Println("✅ MongoDB connected successfully")
 }
 
+// Reachable tells whether the database answers, for tests that need one
+func Reachable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return Client.Ping(ctx, nil) == nil
+}
+
+// IntegrationEnabled tells tests whether they may write to the database. They
+// only do when asked to with MONGODB_INTEGRATION=true, so running the tests
+// never touches a database configured for the app.
+func IntegrationEnabled() bool {
+	return os.Getenv("MONGODB_INTEGRATION") == "true" && Reachable()
+}
+
 // var Client *mongo.Client = connection_database()
 
 func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
@@ -0,0 +1,212 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var otpCollection *mongo.Collection = database.OpenCollection(database.Client, "otp")
+
+// AccountDeletionGracePeriod is how long a deletion request can still be
+// cancelled before the account is anonymized.
+func AccountDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(getEnv("ACCOUNT_DELETION_GRACE_DAYS", "14"))
+	if err != nil || days < 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// FinalizeAccountDeletion anonymizes a user everywhere.
+// Every member the user claimed is renamed to an anonymous placeholder and
+// unlinked instead of being removed, so balances stay intact for the other
+// members of the trip.
+func FinalizeAccountDeletion(ctx context.Context, uid string) error {
+	var links []models.Member
+	cursor, err := linkedMemberCollection.Find(ctx, bson.M{"uid": uid})
+	if err != nil {
+		return fmt.Errorf("error fetching member links: %w", err)
+	}
+	if err = cursor.All(ctx, &links); err != nil {
+		return fmt.Errorf("error decoding member links: %w", err)
+	}
+
+	for _, link := range links {
+		if link.Trip_ID == nil || link.Name == nil {
+			continue
+		}
+		// Each trip is anonymized as a whole, a failed run picks up the
+		// remaining links the next time
+		err := RunInTransaction(ctx, func(ctx context.Context) error {
+			trip, err := FindTrip(ctx, bson.M{"trip_id": *link.Trip_ID})
+			if err != nil {
+				return fmt.Errorf("error fetching trip: %w", err)
+			}
+			memberKey := *link.Name
+			if link.Member_ID != nil {
+				memberKey = *link.Member_ID
+			}
+			if member := FindTripMember(trip, memberKey); member != nil {
+				anonymousName := "Deleted_User_" + link.ID.Hex()[18:]
+				if err := RenameTripMember(ctx, *link.Trip_ID, *member.Member_ID, *member.Display_Name, anonymousName, nil); err != nil {
+					return err
+				}
+				member.Display_Name = &anonymousName
+				if err := UnlinkTripMember(ctx, *link.Trip_ID, *member); err != nil {
+					return err
+				}
+				if _, err := nudgeCollection.DeleteMany(ctx, bson.M{
+					"trip_id": *link.Trip_ID,
+					"$or": bson.A{
+						bson.M{"from_member_id": *member.Member_ID},
+						bson.M{"to_member_id": *member.Member_ID},
+					},
+				}); err != nil {
+					return fmt.Errorf("error removing nudges: %w", err)
+				}
+			}
+			if _, err := linkedMemberCollection.DeleteOne(ctx, bson.M{"_id": link.ID}); err != nil {
+				return fmt.Errorf("error removing member link: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Hand trips created by the user over to another linked member, or retire
+	// them when nobody else is left to look after them
+	var createdTrips []models.Trip
+	cursor, err = tripCollection.Find(ctx, bson.M{"creator_id": uid})
+	if err != nil {
+		return fmt.Errorf("error fetching created trips: %w", err)
+	}
+	if err = cursor.All(ctx, &createdTrips); err != nil {
+		return fmt.Errorf("error decoding created trips: %w", err)
+	}
+	for _, trip := range createdTrips {
+		var successor models.Member
+		err := linkedMemberCollection.FindOne(ctx, bson.M{"trip_id": trip.Trip_ID}).Decode(&successor)
+		update := bson.M{"$set": bson.M{"creator_id": ""}}
+		if err == nil && successor.Uid != nil {
+			update = bson.M{"$set": bson.M{"creator_id": *successor.Uid}}
+		} else if err == mongo.ErrNoDocuments {
+			update = bson.M{"$set": bson.M{"creator_id": "", "is_deleted": true}}
+		} else if err != nil {
+			return fmt.Errorf("error finding trip successor: %w", err)
+		}
+		if _, err := tripCollection.UpdateOne(ctx, bson.M{"_id": trip.ID}, BumpVersion(update)); err != nil {
+			return fmt.Errorf("error reassigning trip creator: %w", err)
+		}
+	}
+
+	// Friendships, invitations and reminder preferences name the uid directly
+	if _, err := friendshipCollection.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"requester_id": uid},
+		bson.M{"addressee_id": uid},
+	}}); err != nil {
+		return fmt.Errorf("error removing friendships: %w", err)
+	}
+	if _, err := tripInvitationCollection.DeleteMany(ctx, bson.M{"uid": uid}); err != nil {
+		return fmt.Errorf("error removing trip invitations: %w", err)
+	}
+	if _, err := tripInvitationCollection.UpdateMany(ctx, bson.M{"created_by": uid}, bson.M{"$set": bson.M{"created_by": ""}}); err != nil {
+		return fmt.Errorf("error anonymizing sent trip invitations: %w", err)
+	}
+	if _, err := reminderPreferenceCollection.DeleteMany(ctx, bson.M{"uid": uid}); err != nil {
+		return fmt.Errorf("error removing reminder preferences: %w", err)
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": uid}).Decode(&user); err != nil {
+		return fmt.Errorf("error fetching user: %w", err)
+	}
+	if user.Email != nil {
+		if _, err := otpCollection.DeleteMany(ctx, bson.M{"email": *user.Email}); err != nil {
+			return fmt.Errorf("error removing OTPs: %w", err)
+		}
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": uid}, bson.M{
+		"$set": bson.M{
+			"first_name": "Deleted",
+			"last_name":  "User",
+			"is_deleted": true,
+		},
+		"$unset": bson.M{
+			"email":                 "",
+			"phone":                 "",
+			"phone_e164":            "",
+			"phone_hash":            "",
+			"password":              "",
+			"token":                 "",
+			"refresh_token":         "",
+			"deletion_requested_at": "",
+			"deletion_scheduled_at": "",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error anonymizing user: %w", err)
+	}
+
+	log.Printf("Account %s anonymized", uid)
+	return nil
+}
+
+// AccountDeleted tells whether a user's account was anonymized. Their tokens
+// stay valid until they expire, so every authenticated request checks it.
+func AccountDeleted(ctx context.Context, uid string) (bool, error) {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": uid, "is_deleted": true})
+	if err != nil {
+		return false, fmt.Errorf("error checking account: %w", err)
+	}
+	return count > 0, nil
+}
+
+// PurgeDueAccountDeletions finalizes every deletion whose grace period is over.
+func PurgeDueAccountDeletions(ctx context.Context) (int, error) {
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{
+		"deletion_scheduled_at": bson.M{"$lte": time.Now()},
+		"is_deleted":            bson.M{"$ne": true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching scheduled deletions: %w", err)
+	}
+	if err = cursor.All(ctx, &users); err != nil {
+		return 0, fmt.Errorf("error decoding scheduled deletions: %w", err)
+	}
+
+	purged := 0
+	for _, user := range users {
+		if user.User_id == nil {
+			continue
+		}
+		if err := FinalizeAccountDeletion(ctx, *user.User_id); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// ExpireOTPs removes one-time passwords that were used or have expired
+func ExpireOTPs(ctx context.Context) (int, error) {
+	result, err := otpCollection.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"used": true},
+		bson.M{"expires_at": bson.M{"$lte": time.Now()}},
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("error expiring OTPs: %w", err)
+	}
+	return int(result.DeletedCount), nil
+}
@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AllowedAttachmentTypes are the sniffed content types accepted as attachments
+var AllowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+// MaxAttachmentsPerTransaction caps how many files one transaction can carry
+const MaxAttachmentsPerTransaction = 5
+
+// MaxAttachmentBytes is the largest attachment accepted, 5 MB unless configured
+func MaxAttachmentBytes() int64 {
+	limit, err := strconv.ParseInt(getEnv("MAX_ATTACHMENT_BYTES", "5242880"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 5242880
+	}
+	return limit
+}
+
+// SniffAttachmentType works out the content type from the file itself rather
+// than trusting what the client claims, and reports whether it is allowed
+func SniffAttachmentType(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	return contentType, AllowedAttachmentTypes[contentType]
+}
+
+// SaveAttachment stores the file and records it on the transaction
+func SaveAttachment(ctx context.Context, txn models.Transaction, filename, contentType string, data []byte, uploadedBy string) (models.Attachment, error) {
+	store, err := Blobs()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	attachmentID := primitive.NewObjectID().Hex()
+	key := "trips/" + *txn.Trip_ID + "/transactions/" + txn.ID.Hex() + "/" + attachmentID
+	attachment := models.Attachment{
+		Attachment_ID: &attachmentID,
+		Key:           &key,
+		Filename:      &filename,
+		Content_Type:  &contentType,
+		Size:          int64(len(data)),
+		Uploaded_By:   &uploadedBy,
+		Uploaded_At:   time.Now(),
+	}
+
+	if err := store.Put(ctx, key, data, contentType); err != nil {
+		return attachment, fmt.Errorf("error storing attachment: %w", err)
+	}
+
+	// The size guard keeps concurrent uploads from going over the limit
+	result, err := transactionCollection.UpdateOne(ctx,
+		bson.M{
+			"_id": txn.ID,
+			"$or": bson.A{
+				bson.M{"attachments": bson.M{"$exists": false}},
+				bson.M{"attachments." + strconv.Itoa(MaxAttachmentsPerTransaction-1): bson.M{"$exists": false}},
+			},
+		},
+		BumpVersion(bson.M{"$push": bson.M{"attachments": attachment}}),
+	)
+	if err == nil && result.MatchedCount == 0 {
+		err = fmt.Errorf("a transaction can have at most %d attachments", MaxAttachmentsPerTransaction)
+	}
+	if err != nil {
+		if deleteErr := store.Delete(ctx, key); deleteErr != nil {
+			log.Printf("Could not remove orphaned attachment %s: %v", key, deleteErr)
+		}
+		return attachment, err
+	}
+	return attachment, nil
+}
+
+// FindAttachment picks an attachment out of a transaction
+func FindAttachment(txn models.Transaction, attachmentID string) *models.Attachment {
+	if txn.Attachments == nil {
+		return nil
+	}
+	for i, attachment := range *txn.Attachments {
+		if attachment.Attachment_ID != nil && *attachment.Attachment_ID == attachmentID {
+			return &(*txn.Attachments)[i]
+		}
+	}
+	return nil
+}
+
+// DeleteAttachment removes an attachment from its transaction and the blob store
+func DeleteAttachment(ctx context.Context, txn models.Transaction, attachment models.Attachment) error {
+	_, err := transactionCollection.UpdateOne(ctx,
+		bson.M{"_id": txn.ID},
+		BumpVersion(bson.M{"$pull": bson.M{"attachments": bson.M{"attachment_id": attachment.Attachment_ID}}}),
+	)
+	if err != nil {
+		return fmt.Errorf("error removing attachment: %w", err)
+	}
+	if attachment.Key == nil {
+		return nil
+	}
+	store, err := Blobs()
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, *attachment.Key)
+}
+
+// SoftDeleteRetention is how long soft-deleted transactions are kept before
+// they are purged for good
+func SoftDeleteRetention() time.Duration {
+	days, err := strconv.Atoi(getEnv("SOFT_DELETE_RETENTION_DAYS", "30"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeDeletedTransactions permanently removes transactions that were soft
+// deleted longer ago than the retention period, attachments included
+func PurgeDeletedTransactions(ctx context.Context) (int, error) {
+	store, err := Blobs()
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := transactionCollection.Find(ctx, bson.M{
+		"is_deleted": true,
+		"deleted_at": bson.M{"$lte": time.Now().Add(-SoftDeleteRetention())},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching deleted transactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	purged := 0
+	for cursor.Next(ctx) {
+		var txn models.Transaction
+		if err := cursor.Decode(&txn); err != nil {
+			return purged, fmt.Errorf("error decoding transaction: %w", err)
+		}
+		if txn.Attachments != nil {
+			for _, attachment := range *txn.Attachments {
+				if attachment.Key == nil {
+					continue
+				}
+				if err := store.Delete(ctx, *attachment.Key); err != nil {
+					return purged, fmt.Errorf("error deleting attachment: %w", err)
+				}
+			}
+		}
+		if _, err := transactionCollection.DeleteOne(ctx, bson.M{"_id": txn.ID}); err != nil {
+			return purged, fmt.Errorf("error purging transaction: %w", err)
+		}
+		purged++
+	}
+	return purged, cursor.Err()
+}
@@ -0,0 +1,175 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"fmt"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Counterparty is someone a user settles with inside one trip.
+// A positive Amount means they owe the user, a negative one that the user owes them.
+type Counterparty struct {
+	Member_ID string  `json:"member_id,omitempty"`
+	Name      string  `json:"name"`
+	Uid       string  `json:"uid,omitempty"`
+	Amount    float64 `json:"amount"`
+}
+
+// TripPosition is where a user stands in one of their trips, in the trip's currency
+type TripPosition struct {
+	Trip_ID        string         `json:"trip_id"`
+	Trip_Name      string         `json:"trip_name"`
+	Currency       string         `json:"currency"`
+	Member_ID      string         `json:"member_id"`
+	Balance        float64        `json:"balance"`
+	Counterparties []Counterparty `json:"counterparties"`
+}
+
+// UserTripPositions works out the caller's balance and settlements in every
+// trip they are linked to, following the LinkedMembers uid to member mapping
+func UserTripPositions(ctx context.Context, uid string) ([]TripPosition, error) {
+	var links []models.Member
+	cursor, err := linkedMemberCollection.Find(ctx, bson.M{"uid": uid})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching member links: %w", err)
+	}
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, fmt.Errorf("error decoding member links: %w", err)
+	}
+
+	positions := make([]TripPosition, 0, len(links))
+	for _, link := range links {
+		if link.Trip_ID == nil {
+			continue
+		}
+		trip, err := FindTrip(ctx, bson.M{"trip_id": *link.Trip_ID, "is_deleted": bson.M{"$ne": true}})
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching trip: %w", err)
+		}
+		me := TripMemberOfUser(trip, uid)
+		if me == nil {
+			continue
+		}
+
+		transactions, err := TripTransactions(ctx, *trip.Trip_ID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching transactions: %w", err)
+		}
+		balances, _ := MemberBalances(transactions)
+
+		position := TripPosition{
+			Trip_ID:        *trip.Trip_ID,
+			Currency:       TripCurrency(trip),
+			Member_ID:      *me.Member_ID,
+			Balance:        MemberBalance(balances, *me),
+			Counterparties: make([]Counterparty, 0),
+		}
+		if trip.Name != nil {
+			position.Trip_Name = *trip.Name
+		}
+
+		for _, s := range CalculateSettlements(transactions) {
+			var other Counterparty
+			switch *me.Member_ID {
+			case s.To_ID:
+				other = Counterparty{Member_ID: s.From_ID, Name: s.From, Amount: s.Amount}
+			case s.From_ID:
+				other = Counterparty{Member_ID: s.To_ID, Name: s.To, Amount: -s.Amount}
+			default:
+				continue
+			}
+			if member := FindTripMember(trip, other.Member_ID); member != nil && member.Uid != nil {
+				other.Uid = *member.Uid
+			}
+			position.Counterparties = append(position.Counterparties, other)
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// CurrencyTotals are amounts summed per currency, amounts in different
+// currencies are never added up
+type CurrencyTotals map[string]float64
+
+// BalancesByUser sums what every other user owes the caller across trips,
+// per currency
+func BalancesByUser(positions []TripPosition) map[string]CurrencyTotals {
+	totals := make(map[string]CurrencyTotals)
+	for _, position := range positions {
+		for _, other := range position.Counterparties {
+			if other.Uid == "" {
+				continue
+			}
+			if totals[other.Uid] == nil {
+				totals[other.Uid] = make(CurrencyTotals)
+			}
+			totals[other.Uid][position.Currency] += other.Amount
+		}
+	}
+	return totals
+}
+
+// TripAmount is one trip's share of a CounterpartySummary
+type TripAmount struct {
+	Trip_ID   string  `json:"trip_id"`
+	Trip_Name string  `json:"trip_name"`
+	Amount    float64 `json:"amount"`
+}
+
+// CounterpartySummary is what the user and one counterparty owe each other
+// overall in one currency
+type CounterpartySummary struct {
+	Uid      string       `json:"uid,omitempty"`
+	Name     string       `json:"name"`
+	Currency string       `json:"currency"`
+	Amount   float64      `json:"amount"`
+	Trips    []TripAmount `json:"trips"`
+}
+
+// SummarizeCounterparties lists the user's counterparties across trips.
+// With netting, amounts owed both ways between the same two users in different
+// trips of the same currency are combined into one line; members nobody
+// claimed are always listed per trip.
+func SummarizeCounterparties(positions []TripPosition, net bool) []CounterpartySummary {
+	summaries := make([]CounterpartySummary, 0)
+	byUser := make(map[string]int)
+
+	for _, position := range positions {
+		for _, other := range position.Counterparties {
+			share := TripAmount{Trip_ID: position.Trip_ID, Trip_Name: position.Trip_Name, Amount: other.Amount}
+			key := other.Uid + "|" + position.Currency
+			if idx, ok := byUser[key]; ok && net && other.Uid != "" {
+				summaries[idx].Amount += other.Amount
+				summaries[idx].Trips = append(summaries[idx].Trips, share)
+				continue
+			}
+			if other.Uid != "" {
+				byUser[key] = len(summaries)
+			}
+			summaries = append(summaries, CounterpartySummary{
+				Uid:      other.Uid,
+				Name:     other.Name,
+				Currency: position.Currency,
+				Amount:   other.Amount,
+				Trips:    []TripAmount{share},
+			})
+		}
+	}
+
+	// Netting can cancel debts out completely
+	settled := summaries[:0]
+	for _, summary := range summaries {
+		if math.Abs(summary.Amount) > 0.01 {
+			settled = append(settled, summary)
+		}
+	}
+	return settled
+}
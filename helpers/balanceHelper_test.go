@@ -0,0 +1,27 @@
+package helpers
+
+import "testing"
+
+func TestCrossTripTotalsKeepCurrenciesApart(t *testing.T) {
+	positions := []TripPosition{
+		{Trip_ID: "goa", Currency: "INR", Counterparties: []Counterparty{{Uid: "bob", Name: "Bob", Amount: 500}}},
+		{Trip_ID: "paris", Currency: "EUR", Counterparties: []Counterparty{{Uid: "bob", Name: "Bob", Amount: -20}}},
+		{Trip_ID: "kerala", Currency: "INR", Counterparties: []Counterparty{{Uid: "bob", Name: "Bob", Amount: -200}}},
+	}
+
+	balances := BalancesByUser(positions)
+	if got := balances["bob"]; len(got) != 2 || got["INR"] != 300 || got["EUR"] != -20 {
+		t.Errorf("BalancesByUser = %v, want INR 300 and EUR -20", got)
+	}
+
+	summaries := SummarizeCounterparties(positions, true)
+	if len(summaries) != 2 {
+		t.Fatalf("got %d netted lines, want one per currency: %+v", len(summaries), summaries)
+	}
+	for _, summary := range summaries {
+		want := map[string]float64{"INR": 300, "EUR": -20}[summary.Currency]
+		if summary.Amount != want {
+			t.Errorf("%s line = %v, want %v", summary.Currency, summary.Amount, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// BlobStore keeps binary files such as receipt images outside of Mongo
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var ErrBlobNotFound = errors.New("Blob not found")
+
+var blobKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+(/[A-Za-z0-9_\-.]+)*$`)
+
+func validBlobKey(key string) bool {
+	return blobKeyPattern.MatchString(key) && !strings.Contains(key, "..")
+}
+
+var (
+	blobStore     BlobStore
+	blobStoreErr  error
+	blobStoreOnce sync.Once
+)
+
+// Blobs returns the configured store: BLOB_STORE=s3 for S3 or anything
+// speaking its API, the local filesystem otherwise
+func Blobs() (BlobStore, error) {
+	blobStoreOnce.Do(func() {
+		switch getEnv("BLOB_STORE", "local") {
+		case "s3":
+			blobStore, blobStoreErr = NewS3BlobStoreFromEnv()
+		case "local":
+			blobStore = LocalBlobStore{Root: getEnv("BLOB_LOCAL_DIR", filepath.Join(os.TempDir(), "splitexpress-blobs"))}
+		default:
+			blobStoreErr = fmt.Errorf("unknown BLOB_STORE %q", getEnv("BLOB_STORE", ""))
+		}
+	})
+	return blobStore, blobStoreErr
+}
+
+// LocalBlobStore keeps blobs as files under Root
+type LocalBlobStore struct {
+	Root string
+}
+
+func (s LocalBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+func (s LocalBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write next to the target and rename so readers never see half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (s LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCategories are available in every trip, next to the trip's own
+var DefaultCategories = []string{"food", "transport", "lodging", "activities"}
+
+// Uncategorized is the spend bucket for expenses recorded without a category
+const Uncategorized = "uncategorized"
+
+// NormalizeCategory is the form categories are stored and compared in
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// TripCategories lists the default categories followed by the trip's custom ones
+func TripCategories(trip models.Trip) []string {
+	categories := append([]string{}, DefaultCategories...)
+	if trip.Categories != nil {
+		categories = append(categories, *trip.Categories...)
+	}
+	return categories
+}
+
+// ValidCategory tells whether a normalized category can be used in the trip
+func ValidCategory(trip models.Trip, category string) bool {
+	for _, existing := range TripCategories(trip) {
+		if existing == category {
+			return true
+		}
+	}
+	return false
+}
+
+// CategorySpend adds up the expenses of a trip per category. Settlements
+// move money between members and are not spending, so they are left out.
+func CategorySpend(transactions []models.Transaction) (spend map[string]float64, total float64) {
+	spend = make(map[string]float64)
+	for _, t := range transactions {
+		if t.Amount == nil || t.Type == nil || *t.Type != "Paid" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(*t.Amount, 64)
+		if err != nil {
+			continue
+		}
+		category := Uncategorized
+		if t.Category != nil {
+			category = *t.Category
+		}
+		spend[category] += amount
+		total += amount
+	}
+	return spend, total
+}
+
+// CheckBudgets records a BUDGET_EXCEEDED event for every budget the new
+// expense pushed over its limit. Budgets that were already exceeded stay quiet.
+func CheckBudgets(ctx context.Context, trip models.Trip, expense models.Transaction, actorID string) error {
+	if trip.Total_Budget == nil && len(trip.Category_Budgets) == 0 {
+		return nil
+	}
+	amount, err := strconv.ParseFloat(*expense.Amount, 64)
+	if err != nil {
+		return nil
+	}
+
+	transactions, err := TripTransactions(ctx, *trip.Trip_ID)
+	if err != nil {
+		return fmt.Errorf("error fetching transactions: %w", err)
+	}
+	spend, total := CategorySpend(transactions)
+
+	exceeded := func(budget, after float64) bool {
+		return after > budget && after-amount <= budget
+	}
+	if trip.Total_Budget != nil && exceeded(*trip.Total_Budget, total) {
+		if err := RecordTripEvent(ctx, *trip.Trip_ID, "BUDGET_EXCEEDED", actorID, "", map[string]interface{}{
+			"category": "total",
+			"budget":   *trip.Total_Budget,
+			"spent":    total,
+		}); err != nil {
+			return err
+		}
+	}
+	if expense.Category != nil {
+		budget, ok := trip.Category_Budgets[*expense.Category]
+		if ok && exceeded(budget, spend[*expense.Category]) {
+			if err := RecordTripEvent(ctx, *trip.Trip_ID, "BUDGET_EXCEEDED", actorID, "", map[string]interface{}{
+				"category": *expense.Category,
+				"budget":   budget,
+				"spent":    spend[*expense.Category],
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -5,49 +5,97 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetContactInfoHelper(contacts []models.Contact) ([]models.ContactInfo, error) {
+// MaxContactsPerRequest caps how many contacts one contact sync may look up
+func MaxContactsPerRequest() int {
+	limit, err := strconv.Atoi(getEnv("MAX_CONTACTS_PER_REQUEST", "1000"))
+	if err != nil || limit <= 0 {
+		limit = 1000
+	}
+	return limit
+}
+
+// GetContactInfoHelper finds the registered users among a list of contacts with
+// a single query. Plain numbers are normalized to E.164 using region; in hashed
+// mode every ContactNo is already HashPhone of the E.164 number, which
+// obscures the numbers but doesn't keep them secret.
+func GetContactInfoHelper(contacts []models.Contact, region string, hashed bool) ([]models.ContactInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	var result []models.ContactInfo
+	if region == "" {
+		region = DefaultPhoneRegion()
+	}
 
+	// Step 1: group the contacts by the key users are matched on
+	byKey := make(map[string][]models.Contact)
+	var hashes, numbers, legacyPhones []string
 	for _, contact := range contacts {
-		if contact.ContactNo == nil {
-			log.Printf("Skipping contact with nil ContactNo")
+		if contact.ContactNo == nil || strings.TrimSpace(*contact.ContactNo) == "" {
 			continue
 		}
 
-		// Validate phone number format (basic validation)
-		if *contact.ContactNo == "" {
-			log.Printf("Skipping contact with empty phone number")
+		if hashed {
+			key := strings.ToLower(strings.TrimSpace(*contact.ContactNo))
+			if _, seen := byKey[key]; !seen {
+				hashes = append(hashes, key)
+			}
+			byKey[key] = append(byKey[key], contact)
 			continue
 		}
 
-		// Find user by phone (matches contact.ContactNo)
-		filter := bson.M{"phone": *contact.ContactNo}
-		log.Printf("Searching for user with phone: %s", *contact.ContactNo)
+		e164, ok := NormalizePhone(*contact.ContactNo, region)
+		if !ok {
+			continue
+		}
+		if _, seen := byKey[e164]; !seen {
+			numbers = append(numbers, e164)
+			legacyPhones = append(legacyPhones, phoneLookupVariants(*contact.ContactNo, e164, region)...)
+		}
+		byKey[e164] = append(byKey[e164], contact)
+	}
+
+	result := make([]models.ContactInfo, 0)
+	if len(byKey) == 0 {
+		return result, nil
+	}
 
-		var user struct {
-			User_id    *string `bson:"user_id"`
-			First_Name *string `bson:"First_Name"`
-			Last_Name  *string `bson:"Last_Name"`
+	// Step 2: one query for the whole batch. Users who signed up before numbers
+	// were normalized are still matched on their raw phone.
+	var match bson.A
+	if hashed {
+		match = bson.A{bson.M{"phone_hash": bson.M{"$in": hashes}}}
+	} else {
+		match = bson.A{
+			bson.M{"phone_e164": bson.M{"$in": numbers}},
+			bson.M{"phone": bson.M{"$in": legacyPhones}},
 		}
+	}
+	cursor, err := userCollection.Find(ctx, bson.M{"$or": match, "is_deleted": bson.M{"$ne": true}})
+	if err != nil {
+		return nil, fmt.Errorf("database error while querying users: %w", err)
+	}
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("database error while decoding users: %w", err)
+	}
 
-		err := userCollection.FindOne(ctx, filter).Decode(&user)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				log.Printf("No user found for phone: %s", *contact.ContactNo)
-				continue
-			}
-			log.Printf("Error querying user for phone %s: %v", *contact.ContactNo, err)
-			return nil, fmt.Errorf("database error while querying user: %w", err)
+	// Step 3: map every user back to the contacts it was found for
+	matched := make(map[string]bool)
+	for _, user := range users {
+		key := userPhoneKey(user, region, hashed)
+		if key == "" || matched[key] {
+			continue
 		}
+		matched[key] = true
 
 		var fullName string
 		if user.First_Name != nil {
@@ -60,17 +108,148 @@ func GetContactInfoHelper(contacts []models.Contact) ([]models.ContactInfo, erro
 			fullName += *user.Last_Name
 		}
 
-		contactInfo := models.ContactInfo{
-			Name:      contact.Name,
-			ContactNo: contact.ContactNo,
-			Uid:       user.User_id,
-			UserName:  &fullName,
+		for _, contact := range byKey[key] {
+			name := fullName
+			result = append(result, models.ContactInfo{
+				Name:      contact.Name,
+				ContactNo: contact.ContactNo,
+				Uid:       user.User_id,
+				UserName:  &name,
+			})
 		}
-
-		result = append(result, contactInfo)
-		log.Printf("Successfully processed contact: %s -> User: %s", *contact.ContactNo, fullName)
 	}
 
-	log.Printf("Processed %d contacts, found %d users", len(contacts), len(result))
+	log.Printf("Processed %d contacts, found %d users", len(contacts), len(matched))
 	return result, nil
 }
+
+// userPhoneKey is the key GetContactInfoHelper groups contacts by, computed
+// for a stored user
+func userPhoneKey(user models.User, region string, hashed bool) string {
+	if hashed && user.Phone_Hash != nil {
+		return *user.Phone_Hash
+	}
+	e164 := ""
+	if user.Phone_E164 != nil {
+		e164 = *user.Phone_E164
+	} else if user.Phone != nil {
+		e164, _ = NormalizePhone(*user.Phone, region)
+	}
+	if e164 == "" {
+		return ""
+	}
+	if hashed {
+		return HashPhone(e164)
+	}
+	return e164
+}
+
+// FindUserByPhone finds the registered user owning a phone number
+func FindUserByPhone(ctx context.Context, phone string) (models.User, error) {
+	filter := bson.M{"phone": phone, "is_deleted": bson.M{"$ne": true}}
+	region := DefaultPhoneRegion()
+	if e164, ok := NormalizePhone(phone, region); ok {
+		filter = bson.M{
+			"$or": bson.A{
+				bson.M{"phone_e164": e164},
+				bson.M{"phone": bson.M{"$in": phoneLookupVariants(phone, e164, region)}},
+			},
+			"is_deleted": bson.M{"$ne": true},
+		}
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	return user, err
+}
+
+// SetUserPhone fills the normalized number and its privacy hash of a user
+// about to be saved. It reports false when the phone number is invalid.
+func SetUserPhone(user *models.User, region string) bool {
+	if user.Phone == nil {
+		return false
+	}
+	e164, ok := NormalizePhone(*user.Phone, region)
+	if !ok {
+		return false
+	}
+	hash := HashPhone(e164)
+	user.Phone_E164 = &e164
+	user.Phone_Hash = &hash
+	return true
+}
+
+// BackfillUserPhones normalizes the phone of every user saved before phone
+// numbers were normalized
+func BackfillUserPhones(ctx context.Context) (int, error) {
+	cursor, err := userCollection.Find(ctx, bson.M{
+		"phone":      bson.M{"$exists": true},
+		"phone_e164": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching users to backfill: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	region := DefaultPhoneRegion()
+	updated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return updated, fmt.Errorf("error decoding user: %w", err)
+		}
+		if !SetUserPhone(&user, region) {
+			continue
+		}
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+			"phone_e164": *user.Phone_E164,
+			"phone_hash": *user.Phone_Hash,
+		}}); err != nil {
+			return updated, fmt.Errorf("error backfilling phone: %w", err)
+		}
+		updated++
+	}
+	return updated, cursor.Err()
+}
+
+// DedupeUserPhones settles users whose phones only collide once normalized,
+// such as "+91 98765 43210" and "9876543210", so the unique phone_e164 index
+// can be built. The oldest account keeps the number, the others lose their
+// normalized phone and are logged for follow up; their raw phone stays as is.
+func DedupeUserPhones(ctx context.Context) (int, error) {
+	cursor, err := userCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"phone_e164": bson.M{"$gt": ""}}}},
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":   "$phone_e164",
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error finding duplicate phones: %w", err)
+	}
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return 0, fmt.Errorf("error decoding duplicate phones: %w", err)
+	}
+
+	cleared := 0
+	for _, group := range groups {
+		result, err := userCollection.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": group.IDs[1:]}},
+			bson.M{"$unset": bson.M{"phone_e164": "", "phone_hash": ""}},
+		)
+		if err != nil {
+			return cleared, fmt.Errorf("error clearing duplicate phones: %w", err)
+		}
+		for _, id := range group.IDs[1:] {
+			log.Printf("User %s shares a phone number with user %s, its normalized phone was cleared", id.Hex(), group.IDs[0].Hex())
+		}
+		cleared += int(result.ModifiedCount)
+	}
+	return cleared, nil
+}
@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five field cron expression
+// (minute hour day-of-month month day-of-week)
+type CronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCron understands *, single values, ranges, lists and steps such as
+// "0 9 1 * *" or "*/15 8-18 * * 1-5"
+func ParseCron(expr string) (CronSchedule, error) {
+	var schedule CronSchedule
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, cronRanges[i][0], cronRanges[i][1])
+		if err != nil {
+			return schedule, fmt.Errorf("cron field %d: %w", i+1, err)
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 0 or 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	// Like cron, a day field starting with * (such as */2) counts as unrestricted
+	schedule = CronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	return schedule, nil
+}
+
+func parseCronField(field string, low, high int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, stepText, found := strings.Cut(part, "/"); found {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+			step = n
+			part = base
+		}
+
+		from, to := low, high
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			a, b, _ := strings.Cut(part, "-")
+			var errA, errB error
+			from, errA = strconv.Atoi(a)
+			to, errB = strconv.Atoi(b)
+			if errA != nil || errB != nil {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			from, to = n, n
+			if step > 1 {
+				to = high
+			}
+		}
+		if from < low || to > high || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (s CronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom[t.Day()]
+	dowOK := s.dow[int(t.Weekday())]
+	// Like cron, when both day fields are restricted either one may match
+	if !s.domAny && !s.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// Next returns the first time after t the schedule fires, or the zero time
+// when it never does within the next five years
+func (s CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"mime"
 	"net/smtp"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type EmailConfig struct {
@@ -37,18 +39,40 @@ func getEnv(key, defaultValue string) string {
 }
 
 func SendOTPEmail(toEmail, otp string) error {
+	subject := "Your OTP for Login"
+	body := fmt.Sprintf("Your OTP code is: %s\nThis code will expire in 10 minutes.\nIf you didn't request this code, please ignore this email.", otp)
+	if err := SendEmail(toEmail, subject, body); err != nil {
+		return err
+	}
+
+	log.Printf("OTP email sent successfully to %s", toEmail)
+	return nil
+}
+
+// headerValue folds a value onto one line so it stays inside its header
+func headerValue(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
+
+// buildMessage puts the headers and body of an email together. Header values
+// may come from users, such as a trip name in the subject, and must not be
+// able to start a header of their own.
+func buildMessage(toEmail, fromEmail, subject, body string) string {
+	return fmt.Sprintf(
+		"To: %s\r\nFrom: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		headerValue(toEmail), headerValue(fromEmail), mime.QEncoding.Encode("utf-8", headerValue(subject)), body,
+	)
+}
+
+// SendEmail delivers a plain-text email through the configured SMTP server
+func SendEmail(toEmail, subject, body string) error {
 	config := GetEmailConfig()
 	if config.SMTPUsername == "" || config.SMTPPassword == "" {
 		return fmt.Errorf("SMTP credentials not configured")
 	}
 
 	// Build message
-	subject := "Your OTP for Login"
-	body := fmt.Sprintf("Your OTP code is: %s\nThis code will expire in 10 minutes.\nIf you didn't request this code, please ignore this email.", otp)
-	message := fmt.Sprintf(
-		"To: %s\r\nFrom: %s\r\nSubject: %s\r\n\r\n%s\r\n",
-		toEmail, config.FromEmail, subject, body,
-	)
+	message := buildMessage(toEmail, config.FromEmail, subject, body)
 
 	host := config.SMTPHost
 	port := config.SMTPPort
@@ -98,6 +122,5 @@ func SendOTPEmail(toEmail, otp string) error {
 		return fmt.Errorf("failed to quit SMTP: %w", err)
 	}
 
-	log.Printf("OTP email sent successfully to %s", toEmail)
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMessageKeepsHeadersIntact(t *testing.T) {
+	message := buildMessage("ada@example.com", "app@example.com", "Settle up for Trip\r\nBcc: victim@example.com\r\n\r\nfake body", "Hi")
+	headers, body, found := strings.Cut(message, "\r\n\r\n")
+	if !found {
+		t.Fatal("message has no header block")
+	}
+	lines := strings.Split(headers, "\r\n")
+	if len(lines) != 3 {
+		t.Fatalf("want To, From and Subject headers, got %q", lines)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("subject injected a header: %q", line)
+		}
+	}
+	if body != "Hi\r\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestBuildMessageEncodesSubject(t *testing.T) {
+	message := buildMessage("ada@example.com", "app@example.com", "Settle up for Köln", "Hi")
+	if !strings.Contains(message, "Subject: =?utf-8?q?Settle_up_for_K=C3=B6ln?=\r\n") {
+		t.Errorf("subject is not MIME encoded: %q", message)
+	}
+	message = buildMessage("ada@example.com", "app@example.com", "Settle up for Rome", "Hi")
+	if !strings.Contains(message, "Subject: Settle up for Rome\r\n") {
+		t.Errorf("plain subject changed: %q", message)
+	}
+}
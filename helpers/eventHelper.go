@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tripEventCollection *mongo.Collection = database.OpenCollection(database.Client, "trip_events")
+
+// RecordTripEvent appends an entry to the trip's audit trail
+func RecordTripEvent(ctx context.Context, tripID, eventType, actorID, memberID string, details map[string]interface{}) error {
+	event := models.TripEvent{
+		ID:         primitive.NewObjectID(),
+		Trip_ID:    &tripID,
+		Type:       &eventType,
+		Details:    details,
+		Created_At: time.Now(),
+	}
+	if actorID != "" {
+		event.Actor_ID = &actorID
+	}
+	if memberID != "" {
+		event.Member_ID = &memberID
+	}
+	if _, err := tripEventCollection.InsertOne(ctx, event); err != nil {
+		return err
+	}
+	OnRollback(ctx, func(ctx context.Context) error {
+		_, err := tripEventCollection.DeleteOne(ctx, bson.M{"_id": event.ID})
+		return err
+	})
+	return nil
+}
+
+// TripEvents returns the audit trail of a trip, newest first
+func TripEvents(ctx context.Context, tripID string) ([]models.TripEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := tripEventCollection.Find(ctx, bson.M{"trip_id": tripID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]models.TripEvent, 0)
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
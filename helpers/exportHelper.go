@@ -0,0 +1,217 @@
+package helpers
+
+import (
+	"connection/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// NormalizeCurrency upper-cases an ISO 4217 code and reports whether it looks valid
+func NormalizeCurrency(currency string) (string, bool) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	return currency, currencyPattern.MatchString(currency)
+}
+
+// TripCurrency is the currency amounts of the trip are recorded in
+func TripCurrency(trip models.Trip) string {
+	if trip.Currency != nil {
+		return *trip.Currency
+	}
+	return getEnv("DEFAULT_CURRENCY", "INR")
+}
+
+// LedgerEntry is one transaction as it appears in an export, with the
+// members' current display names
+type LedgerEntry struct {
+	Transaction_ID string    `json:"transaction_id"`
+	Date           time.Time `json:"date"`
+	Type           string    `json:"type"`
+	Payer_ID       string    `json:"payer_id,omitempty"`
+	Payer          string    `json:"payer_name"`
+	Reciver_ID     string    `json:"reciever_id,omitempty"`
+	Reciver        string    `json:"reciever_name"`
+	Category       string    `json:"category"`
+	Description    string    `json:"description"`
+	Amount         string    `json:"amount"`
+	Currency       string    `json:"currency"`
+}
+
+// MemberStatement is a member's net balance in an export
+type MemberStatement struct {
+	Member_ID string  `json:"member_id"`
+	Name      string  `json:"name"`
+	Balance   float64 `json:"balance"`
+}
+
+// TripLedger lists the trip's transactions oldest first, ready to export
+func TripLedger(trip models.Trip, transactions []models.Transaction) []LedgerEntry {
+	sorted := append([]models.Transaction{}, transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created_At.Before(sorted[j].Created_At)
+	})
+
+	currency := TripCurrency(trip)
+	displayName := func(memberID *string, name *string) string {
+		if memberID != nil {
+			if member := FindTripMember(trip, *memberID); member != nil && member.Display_Name != nil {
+				return *member.Display_Name
+			}
+		}
+		if name != nil {
+			return *name
+		}
+		return ""
+	}
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	ledger := make([]LedgerEntry, 0, len(sorted))
+	for _, t := range sorted {
+		category := value(t.Category)
+		if category == "" && value(t.Type) == "Paid" {
+			category = Uncategorized
+		}
+		ledger = append(ledger, LedgerEntry{
+			Transaction_ID: t.ID.Hex(),
+			Date:           t.Created_At,
+			Type:           value(t.Type),
+			Payer_ID:       value(t.Payer_ID),
+			Payer:          displayName(t.Payer_ID, t.PayerName),
+			Reciver_ID:     value(t.Reciver_ID),
+			Reciver:        displayName(t.Reciver_ID, t.ReciverName),
+			Category:       category,
+			Description:    value(t.Description),
+			Amount:         value(t.Amount),
+			Currency:       currency,
+		})
+	}
+	return ledger
+}
+
+// TripStatement is every member's net balance in the trip
+func TripStatement(trip models.Trip, transactions []models.Transaction) []MemberStatement {
+	balances, _ := MemberBalances(transactions)
+	statement := make([]MemberStatement, 0)
+	if trip.Member_List == nil {
+		return statement
+	}
+	for _, member := range *trip.Member_List {
+		statement = append(statement, MemberStatement{
+			Member_ID: *member.Member_ID,
+			Name:      *member.Display_Name,
+			Balance:   MemberBalance(balances, member),
+		})
+	}
+	return statement
+}
+
+// csvSafe keeps a user-entered cell from being run as a formula when the CSV
+// is opened in a spreadsheet
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// WriteLedgerCSV streams the ledger as CSV
+func WriteLedgerCSV(w io.Writer, ledger []LedgerEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"date", "type", "payer", "reciever", "category", "description", "amount", "currency", "transaction_id"}); err != nil {
+		return err
+	}
+	for _, entry := range ledger {
+		if err := writer.Write([]string{
+			entry.Date.Format(time.RFC3339),
+			entry.Type,
+			csvSafe(entry.Payer),
+			csvSafe(entry.Reciver),
+			csvSafe(entry.Category),
+			csvSafe(entry.Description),
+			entry.Amount,
+			entry.Currency,
+			entry.Transaction_ID,
+		}); err != nil {
+			return err
+		}
+		writer.Flush()
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// TripStatementPDF renders a printable statement: member balances, the
+// settlement plan and the full ledger
+func TripStatementPDF(trip models.Trip, ledger []LedgerEntry, statement []MemberStatement, settlements []Settlement) []byte {
+	currency := TripCurrency(trip)
+	money := func(amount float64) string {
+		return strconv.FormatFloat(amount, 'f', 2, 64) + " " + currency
+	}
+	tripName := ""
+	if trip.Name != nil {
+		tripName = *trip.Name
+	}
+
+	doc := newPDFDocument()
+	doc.Writeln("Trip statement: "+tripName, 18, true)
+	doc.Writeln("Generated "+time.Now().UTC().Format("02 Jan 2006 15:04 MST"), 9, false)
+	doc.Line(10)
+
+	doc.Writeln("Member balances", 13, true)
+	for _, member := range statement {
+		doc.Text(0, member.Name, 10, false)
+		doc.Text(300, money(member.Balance), 10, false)
+		doc.Line(15)
+	}
+	doc.Line(10)
+
+	doc.Writeln("Settlement plan", 13, true)
+	if len(settlements) == 0 {
+		doc.Writeln("Everyone is settled up.", 10, false)
+	}
+	for _, s := range settlements {
+		doc.Writeln(fmt.Sprintf("%s pays %s %s", s.From, s.To, money(s.Amount)), 10, false)
+	}
+	doc.Line(10)
+
+	doc.Writeln("Transactions", 13, true)
+	header := []string{"Date", "Type", "Payer", "Reciever", "Category", "Amount"}
+	columns := []float64{0, 65, 115, 215, 315, 400}
+	for i, title := range header {
+		doc.Text(columns[i], title, 9, true)
+	}
+	doc.Line(14)
+	for _, entry := range ledger {
+		values := []string{entry.Date.Format("2006-01-02"), entry.Type, entry.Payer, entry.Reciver, entry.Category, entry.Amount + " " + entry.Currency}
+		for i, v := range values {
+			doc.Text(columns[i], truncate(v, 18), 9, false)
+		}
+		doc.Line(12)
+		if entry.Description != "" {
+			doc.Text(65, truncate(entry.Description, 90), 8, false)
+			doc.Line(12)
+		}
+	}
+
+	return doc.Bytes()
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
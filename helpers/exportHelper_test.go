@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestWriteLedgerCSVEscapesFormulas(t *testing.T) {
+	entry := LedgerEntry{
+		Transaction_ID: "t1",
+		Date:           time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		Type:           "Pay",
+		Payer:          "=HYPERLINK(\"http://evil\")",
+		Reciver:        "@SUM(A1)",
+		Category:       "+food",
+		Description:    "-2+3",
+		Amount:         "12.50",
+		Currency:       "EUR",
+	}
+	var out bytes.Buffer
+	if err := WriteLedgerCSV(&out, []LedgerEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := rows[1]
+	want := map[int]string{
+		2: "'=HYPERLINK(\"http://evil\")",
+		3: "'@SUM(A1)",
+		4: "'+food",
+		5: "'-2+3",
+		6: "12.50",
+	}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("column %s = %q, want %q", rows[0][column], row[column], value)
+		}
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	cases := map[string]string{
+		"":          "",
+		"Dinner":    "Dinner",
+		"a=b":       "a=b",
+		"=1+1":      "'=1+1",
+		"\tcmd":     "'\tcmd",
+		"\rcmd":     "'\rcmd",
+		"Ölbier -5": "Ölbier -5",
+	}
+	for in, want := range cases {
+		if got := csvSafe(in); got != want {
+			t.Errorf("csvSafe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
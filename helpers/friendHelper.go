@@ -0,0 +1,209 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var friendshipCollection *mongo.Collection = database.OpenCollection(database.Client, "friendships")
+
+var ErrAlreadyFriends = errors.New("You are already friends")
+var ErrFriendRequestPending = errors.New("A friend request is already pending")
+
+// friendshipBetween matches the friendship of two users whoever sent the request
+func friendshipBetween(a, b string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"requester_id": a, "addressee_id": b},
+		bson.M{"requester_id": b, "addressee_id": a},
+	}}
+}
+
+// FindFriendship loads the friendship or friend request between two users
+func FindFriendship(ctx context.Context, a, b string) (models.Friendship, error) {
+	var friendship models.Friendship
+	filter := friendshipBetween(a, b)
+	filter["status"] = bson.M{"$in": bson.A{"PENDING", "ACCEPTED"}}
+	err := friendshipCollection.FindOne(ctx, filter).Decode(&friendship)
+	return friendship, err
+}
+
+// SendFriendRequest asks another user to be friends.
+// If they had already asked the sender, their request is accepted instead.
+func SendFriendRequest(ctx context.Context, from, to string) (models.Friendship, error) {
+	existing, err := FindFriendship(ctx, from, to)
+	if err == nil {
+		if *existing.Status == "ACCEPTED" {
+			return existing, ErrAlreadyFriends
+		}
+		if *existing.Requester_ID == from {
+			return existing, ErrFriendRequestPending
+		}
+		return existing, RespondToFriendRequest(ctx, existing.ID, true)
+	}
+	if err != mongo.ErrNoDocuments {
+		return existing, fmt.Errorf("error checking existing friendship: %w", err)
+	}
+
+	status := "PENDING"
+	friendship := models.Friendship{
+		ID:           primitive.NewObjectID(),
+		Requester_ID: &from,
+		Addressee_ID: &to,
+		Status:       &status,
+		Created_At:   time.Now(),
+	}
+	if _, err := friendshipCollection.InsertOne(ctx, friendship); err != nil {
+		return friendship, fmt.Errorf("error saving friend request: %w", err)
+	}
+	return friendship, nil
+}
+
+// FindFriendRequest loads a single friend request by id
+func FindFriendRequest(ctx context.Context, requestID string) (models.Friendship, error) {
+	var friendship models.Friendship
+	objectID, err := primitive.ObjectIDFromHex(requestID)
+	if err != nil {
+		return friendship, mongo.ErrNoDocuments
+	}
+	err = friendshipCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&friendship)
+	return friendship, err
+}
+
+// RespondToFriendRequest accepts or declines a pending friend request
+func RespondToFriendRequest(ctx context.Context, id primitive.ObjectID, accept bool) error {
+	status := "DECLINED"
+	if accept {
+		status = "ACCEPTED"
+	}
+	_, err := friendshipCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": "PENDING"},
+		bson.M{"$set": bson.M{"status": status, "responded_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating friend request: %w", err)
+	}
+	return nil
+}
+
+// RemoveFriend ends a friendship or withdraws a pending request
+func RemoveFriend(ctx context.Context, a, b string) (bool, error) {
+	filter := friendshipBetween(a, b)
+	filter["status"] = bson.M{"$in": bson.A{"PENDING", "ACCEPTED"}}
+	result, err := friendshipCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("error removing friend: %w", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ListFriendships returns the caller's friendships with the given status, newest first
+func ListFriendships(ctx context.Context, uid, status string) ([]models.Friendship, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := friendshipCollection.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"requester_id": uid},
+			bson.M{"addressee_id": uid},
+		},
+		"status": status,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	friendships := make([]models.Friendship, 0)
+	if err := cursor.All(ctx, &friendships); err != nil {
+		return nil, err
+	}
+	return friendships, nil
+}
+
+// OtherUser is the uid on the other side of a friendship
+func OtherUser(friendship models.Friendship, uid string) string {
+	if friendship.Requester_ID != nil && *friendship.Requester_ID != uid {
+		return *friendship.Requester_ID
+	}
+	if friendship.Addressee_ID != nil {
+		return *friendship.Addressee_ID
+	}
+	return ""
+}
+
+// SharedTripCounts counts, for every user the caller travelled with, how many
+// trips they were both linked to
+func SharedTripCounts(ctx context.Context, uid string) (map[string]int, error) {
+	tripIDs, err := linkedMemberCollection.Distinct(ctx, "trip_id", bson.M{"uid": uid})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching trips: %w", err)
+	}
+	counts := make(map[string]int)
+	if len(tripIDs) == 0 {
+		return counts, nil
+	}
+
+	var links []models.Member
+	cursor, err := linkedMemberCollection.Find(ctx, bson.M{
+		"trip_id": bson.M{"$in": tripIDs},
+		"uid":     bson.M{"$ne": uid},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching co-travelers: %w", err)
+	}
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, fmt.Errorf("error decoding co-travelers: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if link.Uid == nil || link.Trip_ID == nil || seen[*link.Uid+"/"+*link.Trip_ID] {
+			continue
+		}
+		seen[*link.Uid+"/"+*link.Trip_ID] = true
+		counts[*link.Uid]++
+	}
+	return counts, nil
+}
+
+// PublicUsers loads the public profile of every active user among uids
+func PublicUsers(ctx context.Context, uids []string) (map[string]models.PublicUser, error) {
+	profiles := make(map[string]models.PublicUser)
+	if len(uids) == 0 {
+		return profiles, nil
+	}
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{
+		"user_id":    bson.M{"$in": uids},
+		"is_deleted": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %w", err)
+	}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	for _, user := range users {
+		if user.User_id != nil {
+			profiles[*user.User_id] = user.Public()
+		}
+	}
+	return profiles, nil
+}
+
+// AreFriends tells whether two users have an accepted friendship
+func AreFriends(ctx context.Context, a, b string) (bool, error) {
+	friendship, err := FindFriendship(ctx, a, b)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return *friendship.Status == "ACCEPTED", nil
+}
@@ -0,0 +1,139 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var idempotencyCollection *mongo.Collection = database.OpenCollection(database.Client, "idempotency_keys")
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const MaxIdempotencyKeyLength = 255
+
+// MaxReplayedResponseBytes is the largest response kept for replay, bigger
+// ones release their key instead
+const MaxReplayedResponseBytes = 1 << 20
+
+// idempotencyLockTimeout is how long a request may hold its key before a
+// retry can take it over, so a crashed invocation doesn't block it for good
+const idempotencyLockTimeout = 2 * time.Minute
+
+var ErrIdempotencyKeyReused = errors.New("This Idempotency-Key was already used with a different request")
+var ErrIdempotencyKeyInProgress = errors.New("A request with this Idempotency-Key is still being processed")
+
+// IdempotencyTTL is how long a response is replayed for its key
+func IdempotencyTTL() time.Duration {
+	hours, err := strconv.Atoi(getEnv("IDEMPOTENCY_TTL_HOURS", "24"))
+	if err != nil || hours < 1 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// IdempotencyRecordID scopes a key to the user and the endpoint, so two users
+// or two endpoints never share a key
+func IdempotencyRecordID(uid, method, route, key string) string {
+	return uid + "|" + method + " " + route + "|" + key
+}
+
+// AnonymousIdempotencyScope stands in for the uid on routes called before
+// signing in. Keys are scoped to the email in the body, or the client address
+// without one, so anonymous clients don't share one namespace.
+func AnonymousIdempotencyScope(body []byte, clientIP string) string {
+	var request struct {
+		Email string `json:"email"`
+	}
+	scope := "ip:" + clientIP
+	if json.Unmarshal(body, &request) == nil && strings.TrimSpace(request.Email) != "" {
+		scope = "email:" + strings.ToLower(strings.TrimSpace(request.Email))
+	}
+	hash := sha256.Sum256([]byte(scope))
+	return "anon:" + hex.EncodeToString(hash[:])
+}
+
+// RequestHash fingerprints a request so a reused key can be told apart from a retry
+func RequestHash(query string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(query))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ReserveIdempotencyKey claims a key for a request. It returns the stored
+// record when the key was already completed, ErrIdempotencyKeyInProgress while
+// another request holds it and ErrIdempotencyKeyReused when it was used for a
+// different request. A nil record means the caller owns the key now.
+func ReserveIdempotencyKey(ctx context.Context, id, requestHash string) (*models.IdempotencyRecord, error) {
+	now := time.Now()
+	record := models.IdempotencyRecord{
+		ID:           id,
+		Request_Hash: requestHash,
+		Created_At:   now,
+		Expires_At:   now.Add(IdempotencyTTL()),
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := idempotencyCollection.InsertOne(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing models.IdempotencyRecord
+		err = idempotencyCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue // released in the meantime
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.Request_Hash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.Completed {
+			return &existing, nil
+		}
+		if now.Sub(existing.Created_At) < idempotencyLockTimeout {
+			return nil, ErrIdempotencyKeyInProgress
+		}
+		// The request holding the key never finished, take it over
+		if _, err := idempotencyCollection.DeleteOne(ctx, bson.M{"_id": id, "completed": false, "created_at": existing.Created_At}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrIdempotencyKeyInProgress
+}
+
+// CompleteIdempotencyKey stores the response of a request for replay
+func CompleteIdempotencyKey(ctx context.Context, id string, status int, contentType string, body []byte) error {
+	_, err := idempotencyCollection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"completed":    true,
+			"status_code":  status,
+			"content_type": contentType,
+			"body":         body,
+		}},
+	)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed, so it can be retried
+func ReleaseIdempotencyKey(ctx context.Context, id string) error {
+	_, err := idempotencyCollection.DeleteOne(ctx, bson.M{"_id": id, "completed": false})
+	return err
+}
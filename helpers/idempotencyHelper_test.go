@@ -0,0 +1,23 @@
+package helpers
+
+import "testing"
+
+func TestAnonymousIdempotencyScope(t *testing.T) {
+	alice := AnonymousIdempotencyScope([]byte(`{"email":"alice@example.com","password":"a"}`), "10.0.0.1")
+	bob := AnonymousIdempotencyScope([]byte(`{"email":"bob@example.com","password":"a"}`), "10.0.0.1")
+	if alice == bob {
+		t.Error("two emails share a scope")
+	}
+	if again := AnonymousIdempotencyScope([]byte(`{"email":" Alice@Example.com ","password":"b"}`), "10.0.0.2"); again != alice {
+		t.Error("the same email got a different scope")
+	}
+
+	first := AnonymousIdempotencyScope([]byte(`not json`), "10.0.0.1")
+	second := AnonymousIdempotencyScope([]byte(`{}`), "10.0.0.2")
+	if first == second {
+		t.Error("clients without an email share a scope")
+	}
+	if first == "" || first == alice {
+		t.Errorf("unexpected scope %q", first)
+	}
+}
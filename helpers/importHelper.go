@@ -0,0 +1,450 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxImportRows caps how many transactions one import may create
+func MaxImportRows() int {
+	limit, err := strconv.Atoi(getEnv("MAX_IMPORT_ROWS", "5000"))
+	if err != nil || limit <= 0 {
+		limit = 5000
+	}
+	return limit
+}
+
+// ImportMapping names the CSV column holding each transaction field
+type ImportMapping struct {
+	Date        string `json:"date"`
+	Type        string `json:"type"`
+	Payer       string `json:"payer"`
+	Reciver     string `json:"reciever"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+}
+
+// splitExpressMapping reads the CSV produced by our own ledger export
+var splitExpressMapping = ImportMapping{
+	Date:        "date",
+	Type:        "type",
+	Payer:       "payer",
+	Reciver:     "reciever",
+	Category:    "category",
+	Description: "description",
+	Amount:      "amount",
+	Currency:    "currency",
+}
+
+// ImportRow is one transaction read from an import file
+type ImportRow struct {
+	Line        int       `json:"line"`
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`
+	Payer       string    `json:"payer"`
+	Reciver     string    `json:"reciever"`
+	Category    string    `json:"category,omitempty"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency,omitempty"`
+	Key         string    `json:"-"`
+	Error       string    `json:"error,omitempty"`
+	Duplicate   bool      `json:"duplicate,omitempty"`
+}
+
+var importDateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02", "02/01/2006", "2 Jan 2006"}
+
+func parseImportDate(value string) (time.Time, bool) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseImportAmount(value string) (float64, bool) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, false
+	}
+	return amount, true
+}
+
+func parseImportType(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "settle", "settlement", "payment":
+		return "Settle"
+	default:
+		return "Paid"
+	}
+}
+
+// importKey fingerprints a row so uploading the same file twice imports it once.
+// occurrence tells identical rows of the same file apart.
+func importKey(tripID string, row ImportRow, occurrence int) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		tripID,
+		row.Date.UTC().Format(time.RFC3339),
+		row.Type,
+		strings.ToLower(row.Payer),
+		strings.ToLower(row.Reciver),
+		row.Category,
+		row.Description,
+		strconv.FormatFloat(row.Amount, 'f', 2, 64),
+		strconv.Itoa(occurrence),
+	}, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseImportCSV reads transactions out of a CSV file.
+// format is "splitexpress" (our own export), "splitwise", or "custom" with a mapping.
+func ParseImportCSV(tripID, content, format string, mapping *ImportMapping, maxRows int) ([]ImportRow, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	var rows []ImportRow
+	switch format {
+	case "", "splitexpress":
+		rows, err = parseMappedRows(reader, columns, splitExpressMapping, maxRows)
+	case "custom":
+		if mapping == nil {
+			return nil, fmt.Errorf("a column mapping is required for custom imports")
+		}
+		rows, err = parseMappedRows(reader, columns, *mapping, maxRows)
+	case "splitwise":
+		rows, err = parseSplitwiseRows(reader, header, columns, maxRows)
+	default:
+		return nil, fmt.Errorf("unknown import format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]int)
+	for i := range rows {
+		if rows[i].Error != "" {
+			continue
+		}
+		base := importKey(tripID, rows[i], 0)
+		rows[i].Key = importKey(tripID, rows[i], seen[base])
+		seen[base]++
+	}
+	return rows, nil
+}
+
+func parseMappedRows(reader *csv.Reader, columns map[string]int, mapping ImportMapping, maxRows int) ([]ImportRow, error) {
+	column := func(name string) (int, bool) {
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		return i, ok && name != ""
+	}
+	for field, name := range map[string]string{"payer": mapping.Payer, "reciever": mapping.Reciver, "amount": mapping.Amount} {
+		if _, ok := column(name); !ok {
+			return nil, fmt.Errorf("CSV has no column for %s", field)
+		}
+	}
+
+	rows := make([]ImportRow, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(rows) >= maxRows {
+			return nil, fmt.Errorf("too many rows, at most %d can be imported at once", maxRows)
+		}
+		value := func(name string) string {
+			if i, ok := column(name); ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ImportRow{
+			Line:        line,
+			Type:        parseImportType(value(mapping.Type)),
+			Payer:       value(mapping.Payer),
+			Reciver:     value(mapping.Reciver),
+			Category:    NormalizeCategory(value(mapping.Category)),
+			Description: value(mapping.Description),
+			Currency:    strings.ToUpper(value(mapping.Currency)),
+		}
+		if row.Category == Uncategorized {
+			row.Category = ""
+		}
+		if raw := value(mapping.Date); raw != "" {
+			date, ok := parseImportDate(raw)
+			if !ok {
+				row.Error = "invalid date"
+			}
+			row.Date = date
+		}
+		amount, ok := parseImportAmount(value(mapping.Amount))
+		switch {
+		case !ok || amount <= 0:
+			row.Error = "amount must be a positive number"
+		case row.Payer == "" || row.Reciver == "":
+			row.Error = "payer and reciever are required"
+		case strings.EqualFold(row.Payer, row.Reciver):
+			row.Error = "payer and reciever must differ"
+		}
+		row.Amount = amount
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseSplitwiseRows reads a Splitwise group export. Each row has one column
+// per person with their net share of it; positive shares are owed money.
+// Every row becomes the transactions that settle those shares.
+func parseSplitwiseRows(reader *csv.Reader, header []string, columns map[string]int, maxRows int) ([]ImportRow, error) {
+	currencyCol, ok := columns["currency"]
+	if !ok {
+		return nil, fmt.Errorf("not a Splitwise export: no Currency column")
+	}
+	people := header[currencyCol+1:]
+
+	rows := make([]ImportRow, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		// Blank separator lines and the closing "Total balance" line
+		if value("date") == "" || strings.EqualFold(value("description"), "total balance") {
+			continue
+		}
+
+		base := ImportRow{
+			Line:        line,
+			Description: value("description"),
+			Category:    NormalizeCategory(value("category")),
+			Currency:    strings.ToUpper(value("currency")),
+			Type:        "Paid",
+		}
+		if base.Category == "payment" {
+			base.Type = "Settle"
+			base.Category = ""
+		}
+		date, ok := parseImportDate(value("date"))
+		if !ok {
+			base.Error = "invalid date"
+			rows = append(rows, base)
+			continue
+		}
+		base.Date = date
+
+		type share struct {
+			name   string
+			amount float64
+		}
+		var owed, owing []share
+		for i, person := range people {
+			idx := currencyCol + 1 + i
+			if idx >= len(record) {
+				break
+			}
+			amount, ok := parseImportAmount(record[idx])
+			if !ok {
+				continue
+			}
+			if amount > 0.005 {
+				owed = append(owed, share{strings.TrimSpace(person), amount})
+			} else if amount < -0.005 {
+				owing = append(owing, share{strings.TrimSpace(person), -amount})
+			}
+		}
+		sort.SliceStable(owed, func(i, j int) bool { return owed[i].amount > owed[j].amount })
+		sort.SliceStable(owing, func(i, j int) bool { return owing[i].amount > owing[j].amount })
+
+		// Whoever owes is recorded as the payer, matching how balances are computed
+		for i, j := 0, 0; i < len(owing) && j < len(owed); {
+			amount := math.Min(owing[i].amount, owed[j].amount)
+			if amount > 0.005 {
+				if len(rows) >= maxRows {
+					return nil, fmt.Errorf("too many rows, at most %d can be imported at once", maxRows)
+				}
+				row := base
+				row.Payer = owing[i].name
+				row.Reciver = owed[j].name
+				row.Amount = math.Round(amount*100) / 100
+				rows = append(rows, row)
+			}
+			owing[i].amount -= amount
+			owed[j].amount -= amount
+			if owing[i].amount <= 0.005 {
+				i++
+			}
+			if owed[j].amount <= 0.005 {
+				j++
+			}
+		}
+	}
+	return rows, nil
+}
+
+// NameMatch is how a name from an import file resolves to a trip member
+type NameMatch struct {
+	Name         string  `json:"name"`
+	Member_ID    string  `json:"member_id,omitempty"`
+	Display_Name string  `json:"display_name,omitempty"`
+	Match        string  `json:"match"` // exact, fuzzy or none
+	Score        float64 `json:"score"`
+}
+
+func foldName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur := make([]int, len(br)+1)
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(br)]
+}
+
+// MatchMemberName finds the trip member a name from an import most likely
+// means. Names equal up to case, spacing and punctuation are exact matches;
+// otherwise the closest display name is suggested when it is similar enough.
+func MatchMemberName(trip models.Trip, name string) NameMatch {
+	match := NameMatch{Name: name, Match: "none"}
+	if member := FindTripMember(trip, name); member != nil {
+		match.Member_ID, match.Display_Name, match.Match, match.Score = *member.Member_ID, *member.Display_Name, "exact", 1
+		return match
+	}
+	if trip.Member_List == nil {
+		return match
+	}
+
+	folded := foldName(name)
+	for _, member := range *trip.Member_List {
+		candidate := foldName(*member.Display_Name)
+		score := 0.0
+		switch {
+		case candidate == folded:
+			score = 1
+		case folded != "" && (strings.HasPrefix(candidate, folded) || strings.HasPrefix(folded, candidate)):
+			score = 0.8
+		default:
+			longest := max(len([]rune(candidate)), len([]rune(folded)), 1)
+			score = 1 - float64(editDistance(candidate, folded))/float64(longest)
+		}
+		if score > match.Score {
+			match.Member_ID, match.Display_Name, match.Score = *member.Member_ID, *member.Display_Name, score
+		}
+	}
+	switch {
+	case match.Score == 1:
+		match.Match = "exact"
+	case match.Score >= 0.6:
+		match.Match = "fuzzy"
+	default:
+		match.Member_ID, match.Display_Name, match.Score = "", "", 0
+	}
+	return match
+}
+
+// ImportedKeys returns which of the import keys were already imported into the trip
+func ImportedKeys(ctx context.Context, tripID string, keys []string) (map[string]bool, error) {
+	imported := make(map[string]bool)
+	if len(keys) == 0 {
+		return imported, nil
+	}
+	values, err := transactionCollection.Distinct(ctx, "import_key", bson.M{
+		"trip_id":    tripID,
+		"import_key": bson.M{"$in": keys},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error checking previous imports: %w", err)
+	}
+	for _, value := range values {
+		if key, ok := value.(string); ok {
+			imported[key] = true
+		}
+	}
+	return imported, nil
+}
+
+// InsertImportedTransactions saves an import as a whole: when any insert
+// fails, the ones that went through are removed again
+func InsertImportedTransactions(ctx context.Context, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(transactions))
+	ids := make([]primitive.ObjectID, len(transactions))
+	for i, t := range transactions {
+		docs[i] = t
+		ids[i] = t.ID
+	}
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		// Registered first, an insert that fails halfway leaves some documents behind
+		OnRollback(ctx, func(ctx context.Context) error {
+			_, err := transactionCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+			return err
+		})
+		if _, err := transactionCollection.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("import failed and was rolled back: %w", err)
+		}
+		return nil
+	})
+}
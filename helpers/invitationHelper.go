@@ -0,0 +1,156 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tripInvitationCollection *mongo.Collection = database.OpenCollection(database.Client, "trip_invitations")
+
+var ErrInvitationPending = errors.New("There is already a pending invitation or join request for this user")
+
+// CreateTripInvitation records a pending invitation or join request
+func CreateTripInvitation(ctx context.Context, kind, tripID, uid string, memberID *string, createdBy string) (models.TripInvitation, error) {
+	count, err := tripInvitationCollection.CountDocuments(ctx, bson.M{
+		"trip_id": tripID,
+		"uid":     uid,
+		"status":  "PENDING",
+	})
+	if err != nil {
+		return models.TripInvitation{}, fmt.Errorf("error checking pending invitations: %w", err)
+	}
+	if count > 0 {
+		return models.TripInvitation{}, ErrInvitationPending
+	}
+
+	status := "PENDING"
+	invitation := models.TripInvitation{
+		ID:         primitive.NewObjectID(),
+		Trip_ID:    &tripID,
+		Kind:       &kind,
+		Uid:        &uid,
+		Member_ID:  memberID,
+		Created_By: &createdBy,
+		Status:     &status,
+		Created_At: time.Now(),
+	}
+	if _, err := tripInvitationCollection.InsertOne(ctx, invitation); err != nil {
+		return models.TripInvitation{}, fmt.Errorf("error saving invitation: %w", err)
+	}
+	OnRollback(ctx, func(ctx context.Context) error {
+		_, err := tripInvitationCollection.DeleteOne(ctx, bson.M{"_id": invitation.ID})
+		return err
+	})
+	return invitation, nil
+}
+
+// FindTripInvitation loads a single invitation or join request by id
+func FindTripInvitation(ctx context.Context, invitationID string) (models.TripInvitation, error) {
+	var invitation models.TripInvitation
+	objectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return invitation, mongo.ErrNoDocuments
+	}
+	err = tripInvitationCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&invitation)
+	return invitation, err
+}
+
+// ListTripInvitations returns pending invitations matching the filter, newest first
+func ListTripInvitations(ctx context.Context, filter bson.M) ([]models.TripInvitation, error) {
+	filter["status"] = "PENDING"
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := tripInvitationCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	invitations := make([]models.TripInvitation, 0)
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AcceptTripInvitation links the invited user into the trip.
+// The user claims the placeholder named in the invitation, or joins as a new
+// member called displayName when there is none.
+func AcceptTripInvitation(ctx context.Context, invitation models.TripInvitation, displayName string) (models.TripMember, error) {
+	var member models.TripMember
+	err := RunInTransaction(ctx, func(ctx context.Context) error {
+		// Answered first, so of two answers racing each other only one links
+		if err := SetInvitationStatus(ctx, invitation.ID, "ACCEPTED"); err != nil {
+			return err
+		}
+		trip, err := FindTrip(ctx, bson.M{"trip_id": *invitation.Trip_ID})
+		if err != nil {
+			return fmt.Errorf("error finding trip: %w", err)
+		}
+		if err := CheckTripWritable(trip); err != nil {
+			return err
+		}
+
+		if invitation.Member_ID != nil {
+			found := FindTripMember(trip, *invitation.Member_ID)
+			if found == nil {
+				return errors.New("Member not found in trip members")
+			}
+			member = *found
+		} else {
+			member = NewTripMember(displayName, nil)
+			_, err := tripCollection.UpdateOne(ctx,
+				bson.M{"trip_id": *invitation.Trip_ID},
+				BumpVersion(bson.M{"$push": bson.M{"member_list": member, "members": displayName}}),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to add member: %w", err)
+			}
+			OnRollback(ctx, func(ctx context.Context) error {
+				_, err := tripCollection.UpdateOne(ctx,
+					bson.M{"trip_id": *invitation.Trip_ID},
+					BumpVersion(bson.M{"$pull": bson.M{"member_list": bson.M{"member_id": member.Member_ID}, "members": displayName}}),
+				)
+				return err
+			})
+		}
+
+		return ClaimTripMember(ctx, trip, member, *invitation.Uid)
+	})
+	if err != nil {
+		return models.TripMember{}, err
+	}
+	return member, nil
+}
+
+var ErrInvitationAnswered = errors.New("Invitation was already answered")
+
+// SetInvitationStatus closes a pending invitation or join request. Only one
+// answer gets through, the others get ErrInvitationAnswered.
+func SetInvitationStatus(ctx context.Context, invitationID primitive.ObjectID, status string) error {
+	result, err := tripInvitationCollection.UpdateOne(ctx,
+		bson.M{"_id": invitationID, "status": "PENDING"},
+		bson.M{"$set": bson.M{"status": status, "responded_at": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating invitation: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvitationAnswered
+	}
+	// Only pending invitations are ever answered
+	OnRollback(ctx, func(ctx context.Context) error {
+		_, err := tripInvitationCollection.UpdateOne(ctx,
+			bson.M{"_id": invitationID},
+			bson.M{"$set": bson.M{"status": "PENDING"}, "$unset": bson.M{"responded_at": ""}},
+		)
+		return err
+	})
+	return nil
+}
@@ -0,0 +1,174 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInviteRevoked = errors.New("This invite code has been revoked")
+var ErrInviteExpired = errors.New("This invite code has expired")
+var ErrInviteUsedUp = errors.New("This invite code has reached its maximum number of uses")
+var ErrInviteLegacy = errors.New("This invite code is no longer valid, ask a trip admin for a new link")
+
+// inviteCodeFormat matches the codes GenerateInviteCode hands out. Older trips
+// had the guessable name+trip_id as their code.
+var inviteCodeFormat = regexp.MustCompile(`^[A-Z2-7]{26}$`)
+
+// GenerateInviteCode returns a random 128-bit invite code
+func GenerateInviteCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// InviteLink builds the shareable link for an invite code
+func InviteLink(code string) string {
+	base := getEnv("INVITE_BASE_URL", "https://splitexpress.app/join")
+	return base + "?code=" + url.QueryEscape(code)
+}
+
+// ParseInviteCode accepts either a bare invite code or an invite link
+func ParseInviteCode(codeOrLink string) string {
+	codeOrLink = strings.TrimSpace(codeOrLink)
+	if parsed, err := url.Parse(codeOrLink); err == nil && parsed.Scheme != "" {
+		if code := parsed.Query().Get("code"); code != "" {
+			codeOrLink = code
+		}
+	}
+	// Codes are base32, people typing them in often don't keep the case
+	return strings.ToUpper(codeOrLink)
+}
+
+// ValidateInvite checks that the trip's invite code can still be used
+func ValidateInvite(trip models.Trip) error {
+	if err := CheckTripWritable(trip); err != nil {
+		return err
+	}
+	if trip.Invite_Revoked != nil && *trip.Invite_Revoked {
+		return ErrInviteRevoked
+	}
+	if trip.Invite_Code == nil || !inviteCodeFormat.MatchString(*trip.Invite_Code) {
+		return ErrInviteLegacy
+	}
+	if trip.Invite_Expires_At != nil && time.Now().After(*trip.Invite_Expires_At) {
+		return ErrInviteExpired
+	}
+	if trip.Invite_Max_Uses != nil && trip.Invite_Uses != nil && *trip.Invite_Uses >= *trip.Invite_Max_Uses {
+		return ErrInviteUsedUp
+	}
+	return nil
+}
+
+// ConsumeInvite counts one use of the trip's invite code.
+// The max-uses check happens in the same update so concurrent joins can't overshoot it.
+func ConsumeInvite(ctx context.Context, trip models.Trip) error {
+	filter := bson.M{"_id": trip.ID, "invite_code": trip.Invite_Code}
+	if trip.Invite_Max_Uses != nil {
+		filter["$or"] = bson.A{
+			bson.M{"invite_uses": bson.M{"$exists": false}},
+			bson.M{"invite_uses": bson.M{"$lt": *trip.Invite_Max_Uses}},
+		}
+	}
+	result, err := tripCollection.UpdateOne(ctx, filter, BumpVersion(bson.M{"$inc": bson.M{"invite_uses": 1}}))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInviteUsedUp
+	}
+	OnRollback(ctx, func(ctx context.Context) error {
+		return ReleaseInvite(ctx, trip)
+	})
+	return nil
+}
+
+// ReleaseInvite gives back a use taken by ConsumeInvite when the join failed afterwards
+func ReleaseInvite(ctx context.Context, trip models.Trip) error {
+	_, err := tripCollection.UpdateOne(ctx,
+		bson.M{"_id": trip.ID, "invite_code": trip.Invite_Code, "invite_uses": bson.M{"$gt": 0}},
+		BumpVersion(bson.M{"$inc": bson.M{"invite_uses": -1}}),
+	)
+	return err
+}
+
+// RotateInvite replaces the trip's invite code, resetting its use count
+func RotateInvite(ctx context.Context, tripID string, expiresAt *time.Time, maxUses *int) (string, error) {
+	code, err := GenerateInviteCode()
+	if err != nil {
+		return "", err
+	}
+
+	set := bson.M{
+		"invite_code":    code,
+		"invite_uses":    0,
+		"invite_revoked": false,
+	}
+	unset := bson.M{}
+	if expiresAt != nil {
+		set["invite_expires_at"] = *expiresAt
+	} else {
+		unset["invite_expires_at"] = ""
+	}
+	if maxUses != nil {
+		set["invite_max_uses"] = *maxUses
+	} else {
+		unset["invite_max_uses"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	if _, err := tripCollection.UpdateOne(ctx, bson.M{"trip_id": tripID}, BumpVersion(update)); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RotateLegacyInviteCodes gives every trip still on a guessable invite code a
+// random one, keeping its expiry and use limit. Links shared with the old
+// code stop working.
+func RotateLegacyInviteCodes(ctx context.Context) (int, error) {
+	cursor, err := tripCollection.Find(ctx, bson.M{
+		"invite_code": bson.M{"$not": primitive.Regex{Pattern: inviteCodeFormat.String()}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching trips with legacy invite codes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	rotated := 0
+	for cursor.Next(ctx) {
+		var trip models.Trip
+		if err := cursor.Decode(&trip); err != nil {
+			return rotated, fmt.Errorf("error decoding trip: %w", err)
+		}
+		code, err := GenerateInviteCode()
+		if err != nil {
+			return rotated, err
+		}
+		// Matching on the old code leaves a trip rotated in the meantime alone
+		if _, err := tripCollection.UpdateOne(ctx,
+			bson.M{"_id": trip.ID, "invite_code": trip.Invite_Code},
+			BumpVersion(bson.M{"$set": bson.M{"invite_code": code, "invite_uses": 0}}),
+		); err != nil {
+			return rotated, fmt.Errorf("error rotating invite code: %w", err)
+		}
+		rotated++
+	}
+	return rotated, cursor.Err()
+}
@@ -0,0 +1,22 @@
+package helpers
+
+import "testing"
+
+func TestParseInviteCode(t *testing.T) {
+	code := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	for _, input := range []string{
+		code,
+		"abcdefghijklmnopqrstuvwxyz",
+		"  AbCdEfGhIjKlMnOpQrStUvWxYz\n",
+		"https://splitexpress.app/join?code=" + code,
+		"https://splitexpress.app/join?code=abcdefghijklmnopqrstuvwxyz",
+	} {
+		got := ParseInviteCode(input)
+		if got != code {
+			t.Errorf("ParseInviteCode(%q) = %q, want %q", input, got, code)
+		}
+		if !inviteCodeFormat.MatchString(got) {
+			t.Errorf("ParseInviteCode(%q) = %q doesn't look like an invite code", input, got)
+		}
+	}
+}
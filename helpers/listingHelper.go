@@ -0,0 +1,240 @@
+package helpers
+
+import (
+	"connection/models"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// amountValue reads the string amount of a transaction as a number
+var amountValue = bson.M{"$convert": bson.M{
+	"input": "$amount", "to": "double", "onError": 0.0, "onNull": 0.0,
+}}
+
+// missingLast sorts documents without the field after the others, whichever
+// the order
+func missingLast(field string) func(descending bool) interface{} {
+	return func(descending bool) interface{} {
+		fallback := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+		if descending {
+			fallback = time.Unix(0, 0).UTC()
+		}
+		return bson.M{"$ifNull": bson.A{"$" + field, fallback}}
+	}
+}
+
+// lowerCase sorts text fields without regard to case
+func lowerCase(field string) func(descending bool) interface{} {
+	return func(bool) interface{} {
+		return bson.M{"$toLower": bson.M{"$ifNull": bson.A{"$" + field, ""}}}
+	}
+}
+
+// searchPattern matches text anywhere in a field, case-insensitive
+func searchPattern(text string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(strings.TrimSpace(text)), "$options": "i"}
+}
+
+// TransactionPageSpec is the sorting the transaction listing supports
+var TransactionPageSpec = PageSpec{
+	Fields: map[string]SortField{
+		"created_at": {Field: "created_at"},
+		"amount":     {Expr: func(bool) interface{} { return amountValue }},
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: "desc",
+}
+
+// Which transactions a listing shows with regard to soft deletion
+const (
+	DeletedInclude = "include"
+	DeletedExclude = "exclude"
+	DeletedOnly    = "only"
+)
+
+// TransactionFilter narrows down the transactions of a trip.
+// Payer and Receiver are trip members, matched by id or by name for
+// transactions recorded before member ids existed.
+type TransactionFilter struct {
+	TripID    string
+	Payer     *models.TripMember
+	Receiver  *models.TripMember
+	Type      string
+	Category  string
+	From      *time.Time
+	To        *time.Time
+	MinAmount *float64
+	MaxAmount *float64
+	Search    string
+	Deleted   string
+}
+
+// memberMatch matches one side of a transaction against a member
+func memberMatch(idField, nameField string, member models.TripMember) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{idField: *member.Member_ID},
+		bson.M{idField: bson.M{"$exists": false}, nameField: *member.Display_Name},
+	}}
+}
+
+// TransactionListPipeline builds the aggregation stages selecting the
+// transactions of a filter, ready for AggregatePage
+func TransactionListPipeline(filter TransactionFilter) mongo.Pipeline {
+	conditions := bson.A{bson.M{"trip_id": filter.TripID}}
+	switch filter.Deleted {
+	case DeletedExclude:
+		conditions = append(conditions, bson.M{"is_deleted": bson.M{"$ne": true}})
+	case DeletedOnly:
+		conditions = append(conditions, bson.M{"is_deleted": true})
+	}
+	if filter.Payer != nil {
+		conditions = append(conditions, memberMatch("payer_id", "payername", *filter.Payer))
+	}
+	if filter.Receiver != nil {
+		conditions = append(conditions, memberMatch("reciver_id", "recivername", *filter.Receiver))
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, bson.M{"type": filter.Type})
+	}
+	if filter.Category == Uncategorized {
+		conditions = append(conditions, bson.M{"category": bson.M{"$exists": false}})
+	} else if filter.Category != "" {
+		conditions = append(conditions, bson.M{"category": filter.Category})
+	}
+	if filter.From != nil {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$gte": *filter.From}})
+	}
+	if filter.To != nil {
+		conditions = append(conditions, bson.M{"created_at": bson.M{"$lt": *filter.To}})
+	}
+	if filter.Search != "" {
+		pattern := searchPattern(filter.Search)
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"description": pattern},
+			bson.M{"payername": pattern},
+			bson.M{"recivername": pattern},
+		}})
+	}
+
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"$and": conditions}}}}
+	if filter.MinAmount != nil || filter.MaxAmount != nil {
+		// Amounts are stored as strings, so the range is checked on the converted value
+		var bounds bson.A
+		if filter.MinAmount != nil {
+			bounds = append(bounds, bson.M{"$gte": bson.A{amountValue, *filter.MinAmount}})
+		}
+		if filter.MaxAmount != nil {
+			bounds = append(bounds, bson.M{"$lte": bson.A{amountValue, *filter.MaxAmount}})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$expr": bson.M{"$and": bounds}}}})
+	}
+	return pipeline
+}
+
+// TripPageSpec is the sorting the trip listings support
+var TripPageSpec = PageSpec{
+	Fields: map[string]SortField{
+		"created_at": {Field: "created_at"},
+		"name":       {Expr: lowerCase("name")},
+		"start_date": {Expr: missingLast("start_date")},
+		"end_date":   {Expr: missingLast("end_date")},
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: "asc",
+}
+
+// TripFilter narrows down a trip listing
+type TripFilter struct {
+	Status          string
+	Phase           string
+	Destination     string
+	Search          string
+	IncludeArchived bool
+}
+
+// TripPhaseMatch selects the trips in a phase at the given time, mirroring TripPhase
+func TripPhaseMatch(phase string, now time.Time) bson.M {
+	endedBefore := now.AddDate(0, 0, -1)
+	switch phase {
+	case TripUpcoming:
+		return bson.M{"start_date": bson.M{"$gt": now}}
+	case TripPast:
+		return bson.M{
+			"end_date": bson.M{"$lte": endedBefore},
+			"$or": bson.A{
+				bson.M{"start_date": bson.M{"$exists": false}},
+				bson.M{"start_date": bson.M{"$lte": now}},
+			},
+		}
+	case TripOngoing:
+		return bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"start_date": bson.M{"$exists": true}}, bson.M{"end_date": bson.M{"$exists": true}}}},
+			bson.M{"$or": bson.A{bson.M{"start_date": bson.M{"$exists": false}}, bson.M{"start_date": bson.M{"$lte": now}}}},
+			bson.M{"$or": bson.A{bson.M{"end_date": bson.M{"$exists": false}}, bson.M{"end_date": bson.M{"$gt": endedBefore}}}},
+		}}
+	}
+	return bson.M{}
+}
+
+// TripListPipeline builds the aggregation stages selecting the trips of a
+// filter among those matched by scope, ready for AggregatePage
+func TripListPipeline(scope bson.M, filter TripFilter, now time.Time) mongo.Pipeline {
+	conditions := bson.A{scope}
+	switch {
+	case filter.Status == TripActive:
+		// Trips from before lifecycle states have no status and count as active
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": bson.A{TripActive, nil}}})
+	case filter.Status != "":
+		conditions = append(conditions, bson.M{"status": filter.Status})
+	case !filter.IncludeArchived:
+		conditions = append(conditions, bson.M{"status": bson.M{"$ne": TripArchived}})
+	}
+	if filter.Phase != "" {
+		conditions = append(conditions, TripPhaseMatch(filter.Phase, now))
+	}
+	if filter.Destination != "" {
+		conditions = append(conditions, bson.M{"destination": searchPattern(filter.Destination)})
+	}
+	if filter.Search != "" {
+		pattern := searchPattern(filter.Search)
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"name": pattern},
+			bson.M{"description": pattern},
+			bson.M{"destination": pattern},
+		}})
+	}
+	return mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"$and": conditions}}}}
+}
+
+// UserPageSpec is the sorting the admin user listing supports
+var UserPageSpec = PageSpec{
+	Fields: map[string]SortField{
+		"created_at": {Field: "created_at"},
+		"first_name": {Expr: lowerCase("first_name")},
+		"last_name":  {Expr: lowerCase("last_name")},
+		"email":      {Expr: lowerCase("email")},
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: "asc",
+}
+
+// UserListPipeline builds the aggregation stages of the admin user listing
+func UserListPipeline(userType, search string) mongo.Pipeline {
+	conditions := bson.A{bson.M{}}
+	if userType != "" {
+		conditions = append(conditions, bson.M{"user_type": userType})
+	}
+	if search != "" {
+		pattern := searchPattern(search)
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+			bson.M{"email": pattern},
+		}})
+	}
+	return mongo.Pipeline{bson.D{{Key: "$match", Value: bson.M{"$and": conditions}}}}
+}
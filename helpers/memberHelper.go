@@ -0,0 +1,567 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewTripMember creates a member with a fresh member id
+func NewTripMember(displayName string, uid *string) models.TripMember {
+	memberID := primitive.NewObjectID().Hex()
+	name := displayName
+	return models.TripMember{
+		Member_ID:    &memberID,
+		Display_Name: &name,
+		Uid:          uid,
+		Joined_At:    time.Now(),
+	}
+}
+
+// MemberDisplayName is the firstname_lastname name a user gets as a trip
+// member. Missing parts are left out; a user without any name falls back to
+// fallback.
+func MemberDisplayName(firstName, lastName *string, fallback string) string {
+	parts := make([]string, 0, 2)
+	for _, part := range []*string{firstName, lastName} {
+		if part != nil && strings.TrimSpace(*part) != "" {
+			parts = append(parts, strings.TrimSpace(*part))
+		}
+	}
+	if len(parts) == 0 {
+		return fallback
+	}
+	return strings.Join(parts, "_")
+}
+
+// FindTripMember looks a member up by member id, falling back to the display
+// name for clients that still send names
+func FindTripMember(trip models.Trip, idOrName string) *models.TripMember {
+	if trip.Member_List == nil || idOrName == "" {
+		return nil
+	}
+	for i, member := range *trip.Member_List {
+		if member.Member_ID != nil && *member.Member_ID == idOrName {
+			return &(*trip.Member_List)[i]
+		}
+	}
+	for i, member := range *trip.Member_List {
+		if member.Display_Name != nil && *member.Display_Name == idOrName {
+			return &(*trip.Member_List)[i]
+		}
+	}
+	return nil
+}
+
+// MemberNames lists the display names of a trip's members, the shape the
+// legacy `members` field has always had
+func MemberNames(memberList []models.TripMember) []string {
+	names := make([]string, 0, len(memberList))
+	for _, member := range memberList {
+		if member.Display_Name != nil {
+			names = append(names, *member.Display_Name)
+		}
+	}
+	return names
+}
+
+// FindTrip loads a trip and makes sure its members carry member ids
+func FindTrip(ctx context.Context, filter bson.M) (models.Trip, error) {
+	var trip models.Trip
+	if err := tripCollection.FindOne(ctx, filter).Decode(&trip); err != nil {
+		return trip, err
+	}
+	if err := EnsureTripMembers(ctx, &trip); err != nil {
+		return trip, err
+	}
+	return trip, nil
+}
+
+// EnsureTripMembers migrates a trip created before member ids existed.
+// Every name in `members` becomes a TripMember, the LinkedMembers rows and the
+// transactions of the trip are stamped with the new ids, and the list is saved,
+// all of it or none. Trips that already have a member list are left untouched.
+func EnsureTripMembers(ctx context.Context, trip *models.Trip) error {
+	if trip.Member_List != nil || trip.Trip_ID == nil {
+		return nil
+	}
+
+	var links []models.Member
+	cursor, err := linkedMemberCollection.Find(ctx, bson.M{"trip_id": *trip.Trip_ID})
+	if err != nil {
+		return fmt.Errorf("error fetching member links: %w", err)
+	}
+	if err = cursor.All(ctx, &links); err != nil {
+		return fmt.Errorf("error decoding member links: %w", err)
+	}
+	linkedUid := make(map[string]*string)
+	for _, link := range links {
+		if link.Name != nil {
+			linkedUid[*link.Name] = link.Uid
+		}
+	}
+
+	memberList := make([]models.TripMember, 0)
+	if trip.Members != nil {
+		for _, name := range *trip.Members {
+			member := NewTripMember(name, linkedUid[name])
+			member.Joined_At = trip.Created_At
+			memberList = append(memberList, member)
+		}
+	}
+
+	// The member list marks the trip migrated, so it is saved together with
+	// the ids or not at all and a failed migration is tried again
+	migrated := true
+	err = RunInTransaction(ctx, func(ctx context.Context) error {
+		// Only the first writer wins so concurrent readers can't assign two sets of ids
+		result, err := tripCollection.UpdateOne(ctx,
+			bson.M{"_id": trip.ID, "member_list": bson.M{"$exists": false}},
+			BumpVersion(bson.M{"$set": bson.M{"member_list": memberList}}),
+		)
+		if err != nil {
+			return fmt.Errorf("error saving member list: %w", err)
+		}
+		if result.ModifiedCount == 0 {
+			migrated = false
+			return nil
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			_, err := tripCollection.UpdateOne(ctx, bson.M{"_id": trip.ID}, BumpVersion(bson.M{"$unset": bson.M{"member_list": ""}}))
+			return err
+		})
+
+		for _, member := range memberList {
+			memberID := *member.Member_ID
+			name := *member.Display_Name
+
+			OnRollback(ctx, func(ctx context.Context) error {
+				return unstampMemberID(ctx, *trip.Trip_ID, memberID)
+			})
+			if _, err := linkedMemberCollection.UpdateMany(ctx,
+				bson.M{"trip_id": *trip.Trip_ID, "name": name, "member_id": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"member_id": memberID}},
+			); err != nil {
+				return fmt.Errorf("error stamping member links: %w", err)
+			}
+			if _, err := transactionCollection.UpdateMany(ctx,
+				bson.M{"trip_id": *trip.Trip_ID, "payername": name, "payer_id": bson.M{"$exists": false}},
+				BumpVersion(bson.M{"$set": bson.M{"payer_id": memberID}}),
+			); err != nil {
+				return fmt.Errorf("error stamping payer ids: %w", err)
+			}
+			if _, err := transactionCollection.UpdateMany(ctx,
+				bson.M{"trip_id": *trip.Trip_ID, "recivername": name, "reciver_id": bson.M{"$exists": false}},
+				BumpVersion(bson.M{"$set": bson.M{"reciver_id": memberID}}),
+			); err != nil {
+				return fmt.Errorf("error stamping receiver ids: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !migrated {
+		return tripCollection.FindOne(ctx, bson.M{"_id": trip.ID}).Decode(trip)
+	}
+
+	trip.Member_List = &memberList
+	return nil
+}
+
+// unstampMemberID takes a member id back off the links and transactions of a
+// trip when its migration is rolled back
+func unstampMemberID(ctx context.Context, tripID, memberID string) error {
+	if _, err := linkedMemberCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "member_id": memberID},
+		bson.M{"$unset": bson.M{"member_id": ""}},
+	); err != nil {
+		return err
+	}
+	if _, err := transactionCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "payer_id": memberID},
+		BumpVersion(bson.M{"$unset": bson.M{"payer_id": ""}}),
+	); err != nil {
+		return err
+	}
+	_, err := transactionCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "reciver_id": memberID},
+		BumpVersion(bson.M{"$unset": bson.M{"reciver_id": ""}}),
+	)
+	return err
+}
+
+// MigrateAllTripMembers runs EnsureTripMembers over every trip still keyed by names
+func MigrateAllTripMembers(ctx context.Context) (int, error) {
+	cursor, err := tripCollection.Find(ctx, bson.M{"member_list": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching trips to migrate: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var trip models.Trip
+		if err := cursor.Decode(&trip); err != nil {
+			return migrated, fmt.Errorf("error decoding trip: %w", err)
+		}
+		if err := EnsureTripMembers(ctx, &trip); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
+}
+
+// DedupeMemberLinks removes links that claim a member or a user twice in a
+// trip, left behind by claims that raced, keeping the oldest of each
+func DedupeMemberLinks(ctx context.Context) (int, error) {
+	removed := 0
+	for _, field := range []string{"member_id", "uid"} {
+		cursor, err := linkedMemberCollection.Aggregate(ctx, mongo.Pipeline{
+			bson.D{{Key: "$match", Value: bson.M{field: bson.M{"$gt": ""}}}},
+			bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+			bson.D{{Key: "$group", Value: bson.M{
+				"_id":   bson.M{"trip_id": "$trip_id", "key": "$" + field},
+				"ids":   bson.M{"$push": "$_id"},
+				"count": bson.M{"$sum": 1},
+			}}},
+			bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		})
+		if err != nil {
+			return removed, fmt.Errorf("error finding duplicate member links: %w", err)
+		}
+		var groups []struct {
+			IDs []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return removed, fmt.Errorf("error decoding duplicate member links: %w", err)
+		}
+		for _, group := range groups {
+			result, err := linkedMemberCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+			if err != nil {
+				return removed, fmt.Errorf("error removing duplicate member links: %w", err)
+			}
+			removed += int(result.DeletedCount)
+		}
+	}
+	return removed, nil
+}
+
+// LinkedMemberIDs returns the ids of the members of a trip that are claimed by a user.
+// Links created before member ids existed are matched through their name.
+func LinkedMemberIDs(ctx context.Context, trip models.Trip) (map[string]bool, error) {
+	linked := make(map[string]bool)
+	if trip.Trip_ID == nil {
+		return linked, nil
+	}
+
+	var links []models.Member
+	cursor, err := linkedMemberCollection.Find(ctx, bson.M{"trip_id": *trip.Trip_ID})
+	if err != nil {
+		return linked, err
+	}
+	if err = cursor.All(ctx, &links); err != nil {
+		return linked, err
+	}
+
+	for _, link := range links {
+		if link.Member_ID != nil {
+			linked[*link.Member_ID] = true
+		} else if link.Name != nil {
+			if member := FindTripMember(trip, *link.Name); member != nil {
+				linked[*member.Member_ID] = true
+			}
+		}
+	}
+	return linked, nil
+}
+
+var ErrMemberNameTaken = errors.New("Another member of this trip already has this name")
+
+// MemberNameTaken tells whether a member other than memberID goes by name
+func MemberNameTaken(trip models.Trip, memberID, name string) bool {
+	if trip.Member_List == nil {
+		return false
+	}
+	for _, member := range *trip.Member_List {
+		if member.Display_Name != nil && *member.Display_Name == name && (member.Member_ID == nil || *member.Member_ID != memberID) {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameTripMember changes a member's display name on the trip, in the
+// transactions that reference it and in its member link. It fails with
+// ErrMemberNameTaken when another member has the name, and with an expected
+// version with ErrStaleVersion when the trip was changed since.
+func RenameTripMember(ctx context.Context, tripID, memberID, oldName, newName string, expected *int64) error {
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		filter := bson.M{
+			"trip_id":               tripID,
+			"member_list.member_id": memberID,
+			"member_list": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+				"display_name": newName,
+				"member_id":    bson.M{"$ne": memberID},
+			}}},
+		}
+		result, err := tripCollection.UpdateOne(ctx, WithVersion(filter, expected), renameMemberPipeline(memberID, newName))
+		if err != nil {
+			return fmt.Errorf("error renaming trip member: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			trip, err := FindTrip(ctx, bson.M{"trip_id": tripID})
+			if err != nil {
+				return fmt.Errorf("error fetching trip: %w", err)
+			}
+			if MemberNameTaken(trip, memberID, newName) {
+				return ErrMemberNameTaken
+			}
+			return ErrStaleVersion
+		}
+		// Renaming back undoes whatever part of the rename went through
+		OnRollback(ctx, func(ctx context.Context) error {
+			if _, err := tripCollection.UpdateOne(ctx, bson.M{"trip_id": tripID, "member_list.member_id": memberID}, renameMemberPipeline(memberID, oldName)); err != nil {
+				return err
+			}
+			return renameMemberReferences(ctx, tripID, memberID, oldName)
+		})
+
+		return renameMemberReferences(ctx, tripID, memberID, newName)
+	})
+}
+
+// renameMemberPipeline renames a member in `member_list` and rebuilds the
+// legacy `members` names from it, so members sharing the old name can't be
+// mixed up
+func renameMemberPipeline(memberID, name string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"member_list": bson.M{"$map": bson.M{
+			"input": "$member_list",
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$$this.member_id", memberID}},
+				bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"display_name": name}}},
+				"$$this",
+			}},
+		}}}}},
+		{{Key: "$set", Value: bson.M{
+			"members": "$member_list.display_name",
+			// BumpVersion's $inc has no place in a pipeline
+			"version": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+		}}},
+	}
+}
+
+// renameMemberReferences copies a member's name into its transactions and member link
+func renameMemberReferences(ctx context.Context, tripID, memberID, name string) error {
+	_, err := transactionCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "payer_id": memberID},
+		BumpVersion(bson.M{"$set": bson.M{"payername": name}}),
+	)
+	if err != nil {
+		return fmt.Errorf("error renaming payer in transactions: %w", err)
+	}
+	_, err = transactionCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "reciver_id": memberID},
+		BumpVersion(bson.M{"$set": bson.M{"recivername": name}}),
+	)
+	if err != nil {
+		return fmt.Errorf("error renaming receiver in transactions: %w", err)
+	}
+
+	_, err = linkedMemberCollection.UpdateMany(ctx,
+		bson.M{"trip_id": tripID, "member_id": memberID},
+		bson.M{"$set": bson.M{"name": name}},
+	)
+	if err != nil {
+		return fmt.Errorf("error renaming member link: %w", err)
+	}
+	return nil
+}
+
+var ErrMemberAlreadyLinked = errors.New("Member is already linked")
+var ErrUserAlreadyLinked = errors.New("You have already linked with another member in this trip")
+
+// ClaimTripMember links a user to a member placeholder of the trip
+func ClaimTripMember(ctx context.Context, trip models.Trip, member models.TripMember, uid string) error {
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		// Check if member is already linked
+		count, err := linkedMemberCollection.CountDocuments(ctx, bson.M{
+			"trip_id": trip.Trip_ID,
+			"$or": bson.A{
+				bson.M{"member_id": member.Member_ID},
+				bson.M{"member_id": bson.M{"$exists": false}, "name": member.Display_Name},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error checking existing link: %w", err)
+		}
+		if count > 0 {
+			return ErrMemberAlreadyLinked
+		}
+
+		// Check if the user is linked with any member in this trip
+		count, err = linkedMemberCollection.CountDocuments(ctx, bson.M{
+			"trip_id": trip.Trip_ID,
+			"uid":     uid,
+		})
+		if err != nil {
+			return fmt.Errorf("error checking existing member link: %w", err)
+		}
+		if count > 0 {
+			return ErrUserAlreadyLinked
+		}
+
+		// Two claims can both pass the checks above when they race without a
+		// transaction, the unique indexes let only one of them in
+		linkMember := models.Member{
+			ID:        primitive.NewObjectID(),
+			Trip_ID:   trip.Trip_ID,
+			Name:      member.Display_Name,
+			Member_ID: member.Member_ID,
+			Uid:       &uid,
+		}
+		if _, err := linkedMemberCollection.InsertOne(ctx, linkMember); err != nil {
+			switch {
+			case IsDuplicateKeyOn(err, LinkedMemberIDIndex):
+				return ErrMemberAlreadyLinked
+			case IsDuplicateKeyOn(err, LinkedMemberUIDIndex):
+				return ErrUserAlreadyLinked
+			}
+			return fmt.Errorf("failed to insert linked member: %w", err)
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			_, err := linkedMemberCollection.DeleteOne(ctx, bson.M{"_id": linkMember.ID})
+			return err
+		})
+
+		_, err = tripCollection.UpdateOne(ctx,
+			bson.M{"trip_id": trip.Trip_ID, "member_list.member_id": member.Member_ID},
+			BumpVersion(bson.M{"$set": bson.M{"member_list.$.uid": uid}}),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to link trip member: %w", err)
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			return restoreMemberUid(ctx, *trip.Trip_ID, member)
+		})
+		return nil
+	})
+}
+
+// restoreMemberUid puts back the user a trip member was linked to before
+func restoreMemberUid(ctx context.Context, tripID string, member models.TripMember) error {
+	update := bson.M{"$unset": bson.M{"member_list.$.uid": ""}}
+	if member.Uid != nil {
+		update = bson.M{"$set": bson.M{"member_list.$.uid": *member.Uid}}
+	}
+	_, err := tripCollection.UpdateOne(ctx, bson.M{"trip_id": tripID, "member_list.member_id": member.Member_ID}, BumpVersion(update))
+	return err
+}
+
+// IsTripAdmin tells whether the user may manage the trip
+func IsTripAdmin(trip models.Trip, uid string) bool {
+	return uid != "" && trip.Creator_ID != nil && *trip.Creator_ID == uid
+}
+
+// TripMemberOfUser returns the member of the trip the user is linked to
+func TripMemberOfUser(trip models.Trip, uid string) *models.TripMember {
+	if trip.Member_List == nil || uid == "" {
+		return nil
+	}
+	for i, member := range *trip.Member_List {
+		if member.Uid != nil && *member.Uid == uid {
+			return &(*trip.Member_List)[i]
+		}
+	}
+	return nil
+}
+
+// ReassignMemberTransactions moves every transaction of one member over to another
+func ReassignMemberTransactions(ctx context.Context, tripID string, from, to models.TripMember) error {
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, side := range []struct{ idField, nameField string }{
+			{"payer_id", "payername"},
+			{"reciver_id", "recivername"},
+		} {
+			filter := bson.M{"trip_id": tripID, side.idField: from.Member_ID}
+			ids, err := transactionCollection.Distinct(ctx, "_id", filter)
+			if err != nil {
+				return fmt.Errorf("error finding transactions of %s: %w", side.nameField, err)
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			_, err = transactionCollection.UpdateMany(ctx,
+				bson.M{"_id": bson.M{"$in": ids}},
+				BumpVersion(bson.M{"$set": bson.M{side.idField: to.Member_ID, side.nameField: to.Display_Name}}),
+			)
+			if err != nil {
+				return fmt.Errorf("error reassigning %s: %w", side.nameField, err)
+			}
+			idField, nameField := side.idField, side.nameField
+			OnRollback(ctx, func(ctx context.Context) error {
+				_, err := transactionCollection.UpdateMany(ctx,
+					bson.M{"_id": bson.M{"$in": ids}},
+					BumpVersion(bson.M{"$set": bson.M{idField: from.Member_ID, nameField: from.Display_Name}}),
+				)
+				return err
+			})
+		}
+		return nil
+	})
+}
+
+// UnlinkTripMember releases a member placeholder so it can be claimed again
+func UnlinkTripMember(ctx context.Context, tripID string, member models.TripMember) error {
+	return RunInTransaction(ctx, func(ctx context.Context) error {
+		filter := bson.M{
+			"trip_id": tripID,
+			"$or": bson.A{
+				bson.M{"member_id": member.Member_ID},
+				bson.M{"member_id": bson.M{"$exists": false}, "name": member.Display_Name},
+			},
+		}
+		var links []models.Member
+		cursor, err := linkedMemberCollection.Find(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("error fetching member link: %w", err)
+		}
+		if err := cursor.All(ctx, &links); err != nil {
+			return fmt.Errorf("error decoding member link: %w", err)
+		}
+
+		if _, err := linkedMemberCollection.DeleteMany(ctx, filter); err != nil {
+			return fmt.Errorf("error removing member link: %w", err)
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			for _, link := range links {
+				if _, err := linkedMemberCollection.InsertOne(ctx, link); err != nil && !mongo.IsDuplicateKeyError(err) {
+					return err
+				}
+			}
+			return nil
+		})
+
+		_, err = tripCollection.UpdateOne(ctx,
+			bson.M{"trip_id": tripID, "member_list.member_id": member.Member_ID},
+			BumpVersion(bson.M{"$unset": bson.M{"member_list.$.uid": ""}}),
+		)
+		if err != nil {
+			return fmt.Errorf("error unlinking trip member: %w", err)
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			return restoreMemberUid(ctx, tripID, member)
+		})
+		return nil
+	})
+}
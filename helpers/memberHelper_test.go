@@ -0,0 +1,129 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureLinkIndexes creates the unique indexes the migrations put on
+// LinkedMembers, the standalone fallback depends on them
+func ensureLinkIndexes(t *testing.T, ctx context.Context) {
+	t.Helper()
+	nonEmpty := func(field string) *options.IndexOptions {
+		return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}})
+	}
+	_, err := linkedMemberCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "uid", Value: 1}}, Options: nonEmpty("uid").SetName(LinkedMemberUIDIndex)},
+		{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "member_id", Value: 1}}, Options: nonEmpty("member_id").SetName(LinkedMemberIDIndex)},
+	})
+	if err != nil {
+		t.Fatalf("creating LinkedMembers indexes: %v", err)
+	}
+}
+
+func isReplicaSet(ctx context.Context) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	err := database.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	return err == nil && hello.SetName != ""
+}
+
+// raceClaims has n users claim the same placeholder at once and checks only
+// one of them gets it
+func raceClaims(t *testing.T, ctx context.Context, n int) {
+	t.Helper()
+	tripID := "test-" + primitive.NewObjectID().Hex()
+	memberID := primitive.NewObjectID().Hex()
+	name := "placeholder"
+	member := models.TripMember{Member_ID: &memberID, Display_Name: &name}
+	members := []models.TripMember{member}
+	trip := models.Trip{ID: primitive.NewObjectID(), Trip_ID: &tripID, Member_List: &members}
+
+	if _, err := tripCollection.InsertOne(ctx, trip); err != nil {
+		t.Fatalf("inserting trip: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		tripCollection.DeleteOne(ctx, bson.M{"trip_id": tripID})
+		linkedMemberCollection.DeleteMany(ctx, bson.M{"trip_id": tripID})
+	})
+
+	errs := make([]error, n)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			start.Wait()
+			errs[i] = ClaimTripMember(ctx, trip, member, fmt.Sprintf("user-%d", i))
+		}(i)
+	}
+	start.Done()
+	done.Wait()
+
+	var claimed []string
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			claimed = append(claimed, fmt.Sprintf("user-%d", i))
+		case err == ErrMemberAlreadyLinked, err == ErrUserAlreadyLinked:
+		default:
+			t.Errorf("claim %d: unexpected error %v", i, err)
+		}
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("%d claims succeeded, want exactly 1", len(claimed))
+	}
+
+	links, err := linkedMemberCollection.CountDocuments(ctx, bson.M{"trip_id": tripID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links != 1 {
+		t.Errorf("%d links saved, want 1", links)
+	}
+	var saved models.Trip
+	if err := tripCollection.FindOne(ctx, bson.M{"trip_id": tripID}).Decode(&saved); err != nil {
+		t.Fatal(err)
+	}
+	if uid := (*saved.Member_List)[0].Uid; uid == nil || *uid != claimed[0] {
+		t.Errorf("member uid = %v, want %s", uid, claimed[0])
+	}
+}
+
+func TestClaimTripMemberRace(t *testing.T) {
+	if !database.IntegrationEnabled() {
+		t.Skip("set MONGODB_INTEGRATION=true with a reachable MongoDB to run")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	ensureLinkIndexes(t, ctx)
+
+	wasUnsupported := transactionsUnsupported.Load()
+	t.Cleanup(func() { transactionsUnsupported.Store(wasUnsupported) })
+
+	t.Run("transaction", func(t *testing.T) {
+		if !isReplicaSet(ctx) {
+			t.Skip("transactions need a replica set")
+		}
+		transactionsUnsupported.Store(false)
+		raceClaims(t, ctx, 20)
+	})
+	t.Run("standalone fallback", func(t *testing.T) {
+		transactionsUnsupported.Store(true)
+		raceClaims(t, ctx, 20)
+	})
+}
@@ -0,0 +1,233 @@
+package helpers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Page sizes of list endpoints
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// sortKeyField holds the computed sort value of each document while paging
+const sortKeyField = "_sort_key"
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// PageRequest is the pagination and sorting every list endpoint accepts,
+// either as query parameters or inside a JSON body.
+// Cursor is the next_cursor of the previous page and only works with the same sort and order.
+type PageRequest struct {
+	Limit  int    `json:"limit" form:"limit"`
+	Cursor string `json:"cursor" form:"cursor"`
+	Sort   string `json:"sort" form:"sort"`
+	Order  string `json:"order" form:"order"`
+}
+
+// PageInfo tells the client where it is in a listing
+type PageInfo struct {
+	Total_Count int64  `json:"total_count"`
+	Limit       int    `json:"limit"`
+	Has_More    bool   `json:"has_more"`
+	Next_Cursor string `json:"next_cursor,omitempty"`
+}
+
+// SortField is a field a listing can be sorted on. Expr computes the sort
+// value when the stored field can't be compared as is, like amounts kept as
+// strings or dates that may be missing.
+type SortField struct {
+	Field string
+	Expr  func(descending bool) interface{}
+}
+
+// PageSpec describes the sorting a listing supports
+type PageSpec struct {
+	Fields       map[string]SortField
+	DefaultSort  string
+	DefaultOrder string
+}
+
+// pageCursor is what a cursor carries: the sort it belongs to and the sort
+// value and _id of the last document handed out
+type pageCursor struct {
+	Sort  string        `bson:"s"`
+	Order string        `bson:"o"`
+	Value bson.RawValue `bson:"v"`
+	ID    bson.RawValue `bson:"id"`
+}
+
+// ValidatePage fills in the defaults of a page request and checks it against the spec
+func ValidatePage(page *PageRequest, spec PageSpec) error {
+	if page.Limit == 0 {
+		page.Limit = DefaultPageSize
+	}
+	if page.Limit < 1 || page.Limit > MaxPageSize {
+		return errors.New("limit must be between 1 and 100")
+	}
+	if page.Sort == "" {
+		page.Sort = spec.DefaultSort
+	}
+	if _, ok := spec.Fields[page.Sort]; !ok {
+		names := make([]string, 0, len(spec.Fields))
+		for name := range spec.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return errors.New("sort must be one of " + strings.Join(names, ", "))
+	}
+	if page.Order == "" {
+		page.Order = spec.DefaultOrder
+	}
+	if page.Order != "asc" && page.Order != "desc" {
+		return errors.New("order must be asc or desc")
+	}
+	if page.Cursor != "" {
+		if _, err := decodePageCursor(*page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodePageCursor(page PageRequest) (pageCursor, error) {
+	var cursor pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(raw, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != page.Sort || cursor.Order != page.Order || cursor.ID.Type == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func encodePageCursor(cursor pageCursor) (string, error) {
+	if cursor.Value.Type == 0 {
+		cursor.Value = bson.RawValue{Type: bsontype.Null}
+	}
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AggregatePage runs the pipeline and returns one page of its results using
+// keyset pagination on the sort value and _id, so deep pages cost the same as
+// the first and nothing is ever gathered into a single document.
+// The page must have gone through ValidatePage.
+func AggregatePage[T any](ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline, page PageRequest, spec PageSpec) ([]T, PageInfo, error) {
+	info := PageInfo{Limit: page.Limit}
+	descending := page.Order == "desc"
+	direction := 1
+	compare := "$gt"
+	if descending {
+		direction = -1
+		compare = "$lt"
+	}
+
+	// Count before the cursor narrows things down
+	countPipeline := append(append(mongo.Pipeline{}, pipeline...), bson.D{{Key: "$count", Value: "total"}})
+	countCursor, err := collection.Aggregate(ctx, countPipeline)
+	if err != nil {
+		return nil, info, err
+	}
+	var counts []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := countCursor.All(ctx, &counts); err != nil {
+		return nil, info, err
+	}
+	if len(counts) > 0 {
+		info.Total_Count = counts[0].Total
+	}
+
+	field := spec.Fields[page.Sort]
+	sortKey := field.Field
+	stages := append(mongo.Pipeline{}, pipeline...)
+	if field.Expr != nil {
+		sortKey = sortKeyField
+		stages = append(stages, bson.D{{Key: "$addFields", Value: bson.M{sortKeyField: field.Expr(descending)}}})
+	}
+	if page.Cursor != "" {
+		cursor, err := decodePageCursor(page)
+		if err != nil {
+			return nil, info, err
+		}
+		stages = append(stages, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{sortKey: bson.M{compare: cursor.Value}},
+			bson.M{sortKey: cursor.Value, "_id": bson.M{compare: cursor.ID}},
+		}}}})
+	}
+	stages = append(stages,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: sortKey, Value: direction}, {Key: "_id", Value: direction}}}},
+		bson.D{{Key: "$limit", Value: page.Limit + 1}},
+	)
+
+	result, err := collection.Aggregate(ctx, stages)
+	if err != nil {
+		return nil, info, err
+	}
+	var raws []bson.Raw
+	if err := result.All(ctx, &raws); err != nil {
+		return nil, info, err
+	}
+
+	if len(raws) > page.Limit {
+		raws = raws[:page.Limit]
+		last := raws[len(raws)-1]
+		next, err := encodePageCursor(pageCursor{
+			Sort:  page.Sort,
+			Order: page.Order,
+			Value: last.Lookup(strings.Split(sortKey, ".")...),
+			ID:    last.Lookup("_id"),
+		})
+		if err != nil {
+			return nil, info, err
+		}
+		info.Has_More = true
+		info.Next_Cursor = next
+	}
+
+	items := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		if field.Expr != nil {
+			if raw, err = withoutField(raw, sortKeyField); err != nil {
+				return nil, info, err
+			}
+		}
+		var item T
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return nil, info, err
+		}
+		items = append(items, item)
+	}
+	return items, info, nil
+}
+
+// withoutField drops a top-level field from a document
+func withoutField(raw bson.Raw, key string) (bson.Raw, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	kept := make(bson.D, 0, len(doc))
+	for _, element := range doc {
+		if element.Key != key {
+			kept = append(kept, element)
+		}
+	}
+	return bson.Marshal(kept)
+}
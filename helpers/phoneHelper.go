@@ -0,0 +1,107 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// phoneRegion describes how numbers are dialled inside a region
+type phoneRegion struct {
+	callingCode    string
+	nationalLength int
+	trunkPrefix    string
+}
+
+// Regions we normalize national numbers for. Numbers already written in
+// international form work for every country.
+var phoneRegions = map[string]phoneRegion{
+	"IN": {callingCode: "91", nationalLength: 10, trunkPrefix: "0"},
+	"US": {callingCode: "1", nationalLength: 10, trunkPrefix: "1"},
+	"CA": {callingCode: "1", nationalLength: 10, trunkPrefix: "1"},
+	"GB": {callingCode: "44", nationalLength: 10, trunkPrefix: "0"},
+	"AU": {callingCode: "61", nationalLength: 9, trunkPrefix: "0"},
+	"AE": {callingCode: "971", nationalLength: 9, trunkPrefix: "0"},
+	"SG": {callingCode: "65", nationalLength: 8},
+	"FR": {callingCode: "33", nationalLength: 9, trunkPrefix: "0"},
+	"DE": {callingCode: "49", nationalLength: 0, trunkPrefix: "0"},
+}
+
+// DefaultPhoneRegion is the region assumed for numbers without a country code
+func DefaultPhoneRegion() string {
+	return strings.ToUpper(getEnv("DEFAULT_PHONE_REGION", "IN"))
+}
+
+// NormalizePhone turns a phone number as typed into E.164 ("+919876543210").
+// Numbers without a country code are read as national numbers of region.
+// It reports false when the input can't be a valid phone number.
+func NormalizePhone(raw, region string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' || r == '+':
+		default:
+			return "", false
+		}
+	}
+	number := digits.String()
+
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if !international {
+		info, ok := phoneRegions[strings.ToUpper(region)]
+		if !ok {
+			return "", false
+		}
+		switch {
+		case info.nationalLength > 0 && len(number) == info.nationalLength:
+			number = info.callingCode + number
+		case info.nationalLength > 0 && len(number) == len(info.callingCode)+info.nationalLength && strings.HasPrefix(number, info.callingCode):
+			// Country code typed without the plus
+		case info.trunkPrefix != "" && strings.HasPrefix(number, info.trunkPrefix) &&
+			(info.nationalLength == 0 || len(number) == len(info.trunkPrefix)+info.nationalLength):
+			number = info.callingCode + strings.TrimPrefix(number, info.trunkPrefix)
+		case info.nationalLength == 0:
+			number = info.callingCode + number
+		default:
+			return "", false
+		}
+	}
+
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", false
+	}
+	return "+" + number, true
+}
+
+// HashPhone is the hash clients send instead of plain numbers: the hex
+// SHA-256 of the E.164 number. It keeps numbers out of request logs and
+// casual view, but it is NOT a privacy guarantee: there are only about 10^10
+// numbers, so anyone holding a hash, this server included, can brute-force
+// it in minutes. It is unkeyed because clients have to compute it.
+func HashPhone(e164 string) string {
+	sum := sha256.Sum256([]byte(e164))
+	return hex.EncodeToString(sum[:])
+}
+
+// phoneLookupVariants lists the ways a number may have been stored in the raw
+// `phone` field by users who signed up before numbers were normalized
+func phoneLookupVariants(raw, e164, region string) []string {
+	variants := []string{raw, e164}
+	if info, ok := phoneRegions[strings.ToUpper(region)]; ok && strings.HasPrefix(e164, "+"+info.callingCode) {
+		national := strings.TrimPrefix(e164, "+"+info.callingCode)
+		variants = append(variants, national, strings.TrimPrefix(e164, "+"))
+		if info.trunkPrefix != "" {
+			variants = append(variants, info.trunkPrefix+national)
+		}
+	}
+	return variants
+}
@@ -0,0 +1,119 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw, region string
+		want        string
+		ok          bool
+	}{
+		// The same Indian number however it was typed
+		{"+91 98765 43210", "IN", "+919876543210", true},
+		{"9876543210", "IN", "+919876543210", true},
+		{"09876543210", "IN", "+919876543210", true},
+		{"919876543210", "IN", "+919876543210", true},
+		{"0091-98765-43210", "IN", "+919876543210", true},
+
+		// International numbers don't need a region
+		{"+91 98765 43210", "", "+919876543210", true},
+		{"+1 (415) 555-0100", "", "+14155550100", true},
+		{"0044 20 7946 0958", "", "+442079460958", true},
+		{"+91 98765 43210", "us", "+919876543210", true},
+
+		// National numbers are read in the region
+		{"(415) 555-0100", "US", "+14155550100", true},
+		{"1 415 555 0100", "us", "+14155550100", true},
+		{"020 7946 0958", "GB", "+442079460958", true},
+		{"030 1234567", "DE", "+49301234567", true},
+		{"8123 4567", "SG", "+6581234567", true},
+
+		// Rejected
+		{"9876543210", "", "", false},
+		{"9876543210", "ZZ", "", false},
+		{"98765", "IN", "", false},
+		{"98765 432100", "IN", "", false},
+		{"+91 98765 4321a", "IN", "", false},
+		{"call me", "IN", "", false},
+		{"", "IN", "", false},
+		{"+0123456789", "", "", false},
+		{"+1234567890123456", "", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizePhone(tt.raw, tt.region)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizePhone(%q, %q) = %q, %v, want %q, %v", tt.raw, tt.region, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHashedContactMatchesStoredHash(t *testing.T) {
+	phone := "098765 43210"
+	user := models.User{Phone: &phone}
+	if !SetUserPhone(&user, "IN") {
+		t.Fatal("SetUserPhone rejected a valid number")
+	}
+
+	// What a client sends for the contact "+91 98765 43210"
+	e164, _ := NormalizePhone("+91 98765 43210", "")
+	contactHash := strings.ToUpper(HashPhone(e164))
+
+	if *user.Phone_Hash != HashPhone(e164) {
+		t.Errorf("stored hash %s, client hash %s", *user.Phone_Hash, HashPhone(e164))
+	}
+	if key := userPhoneKey(user, "IN", true); key != strings.ToLower(contactHash) {
+		t.Errorf("userPhoneKey = %s, want %s", key, strings.ToLower(contactHash))
+	}
+
+	// Users saved before phones were hashed are matched through their raw phone
+	legacy := models.User{Phone: &phone}
+	if key := userPhoneKey(legacy, "IN", true); key != HashPhone(e164) {
+		t.Errorf("legacy userPhoneKey = %s, want %s", key, HashPhone(e164))
+	}
+}
+
+func TestGetContactInfoHashed(t *testing.T) {
+	if !database.IntegrationEnabled() {
+		t.Skip("set MONGODB_INTEGRATION=true with a reachable MongoDB to run")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// A number unlikely to belong to a real user of the test database
+	phone := fmt.Sprintf("+91 90000 %05d", time.Now().UnixNano()%100000)
+	uid := "test-" + primitive.NewObjectID().Hex()
+	first := "Ada"
+	user := models.User{ID: primitive.NewObjectID(), User_id: &uid, First_Name: &first, Phone: &phone}
+	if !SetUserPhone(&user, "IN") {
+		t.Fatalf("SetUserPhone rejected %q", phone)
+	}
+	if _, err := userCollection.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		userCollection.DeleteOne(ctx, bson.M{"user_id": uid})
+	})
+
+	name := "Ada"
+	hash := strings.ToUpper(HashPhone(*user.Phone_E164))
+	infos, err := GetContactInfoHelper([]models.Contact{{Name: &name, ContactNo: &hash}}, "IN", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Uid == nil || *infos[0].Uid != uid {
+		t.Errorf("hashed contact matched %+v, want user %s", infos, uid)
+	}
+}
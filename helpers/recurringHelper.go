@@ -0,0 +1,521 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var recurringExpenseCollection *mongo.Collection = database.OpenCollection(database.Client, "recurring_expenses")
+
+// maxOccurrencesPerRun stops a long paused or back-dated template from
+// producing an unbounded backlog in a single run
+const maxOccurrencesPerRun = 100
+
+// ValidateRecurringSchedule checks the frequency, interval and cron expression of a template
+func ValidateRecurringSchedule(template models.RecurringExpense) error {
+	if template.Frequency == nil {
+		return fmt.Errorf("frequency is required")
+	}
+	switch *template.Frequency {
+	case "daily", "weekly", "monthly":
+		if template.Interval < 1 {
+			return fmt.Errorf("interval must be at least 1")
+		}
+	case "cron":
+		if template.Cron == nil {
+			return fmt.Errorf("cron expression is required")
+		}
+		if _, err := ParseCron(*template.Cron); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("frequency must be daily, weekly, monthly or cron")
+	}
+	return nil
+}
+
+// addMonths moves t forward by months, keeping the day of the month but
+// clamping it to the last day of shorter months (31 Jan + 1 month = 28 Feb)
+func addMonths(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// OccurrenceFrom returns the first occurrence of the template at or after from,
+// and false once the schedule has ended
+func OccurrenceFrom(template models.RecurringExpense, from time.Time) (time.Time, bool) {
+	if from.Before(template.Start_At) {
+		from = template.Start_At
+	}
+
+	var next time.Time
+	switch *template.Frequency {
+	case "cron":
+		schedule, err := ParseCron(*template.Cron)
+		if err != nil {
+			return time.Time{}, false
+		}
+		next = schedule.Next(from.Add(-time.Nanosecond))
+		if next.IsZero() {
+			return next, false
+		}
+	case "monthly":
+		for k := 0; ; k++ {
+			next = addMonths(template.Start_At, k*template.Interval)
+			if !next.Before(from) {
+				break
+			}
+		}
+	default:
+		days := template.Interval
+		if *template.Frequency == "weekly" {
+			days *= 7
+		}
+		period := time.Duration(days) * 24 * time.Hour
+		steps := 0
+		if elapsed := from.Sub(template.Start_At); elapsed > 0 {
+			steps = int(math.Ceil(float64(elapsed) / float64(period)))
+		}
+		// Days across a DST change are an hour off the period, correct for it
+		for template.Start_At.AddDate(0, 0, steps*days).Before(from) {
+			steps++
+		}
+		for steps > 0 && !template.Start_At.AddDate(0, 0, (steps-1)*days).Before(from) {
+			steps--
+		}
+		next = template.Start_At.AddDate(0, 0, steps*days)
+	}
+
+	if template.End_At != nil && next.After(*template.End_At) {
+		return next, false
+	}
+	return next, true
+}
+
+// ComputeSplit divides total between the participants by the split rule.
+// Shares are rounded to cents and left-over cents go to the first participants,
+// so they always add up to exactly total.
+func ComputeSplit(total float64, participants []string, rule string, values map[string]float64) (map[string]float64, error) {
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("at least one participant is required")
+	}
+	for member, value := range values {
+		if !containsValue(participants, member) {
+			return nil, fmt.Errorf("split value for %s who is not a participant", member)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("split values can't be negative")
+		}
+	}
+
+	raw := make([]float64, len(participants))
+	switch rule {
+	case "", "equal":
+		for i := range participants {
+			raw[i] = total / float64(len(participants))
+		}
+	case "exact":
+		sum := 0.0
+		for i, member := range participants {
+			raw[i] = values[member]
+			sum += values[member]
+		}
+		if math.Abs(sum-total) > 0.005 {
+			return nil, fmt.Errorf("exact amounts add up to %.2f instead of %.2f", sum, total)
+		}
+	case "percent", "shares":
+		sum := 0.0
+		for _, member := range participants {
+			sum += values[member]
+		}
+		if rule == "percent" && math.Abs(sum-100) > 0.001 {
+			return nil, fmt.Errorf("percentages add up to %.2f instead of 100", sum)
+		}
+		if sum == 0 {
+			return nil, fmt.Errorf("shares add up to 0")
+		}
+		for i, member := range participants {
+			raw[i] = total * values[member] / sum
+		}
+	default:
+		return nil, fmt.Errorf("split rule must be equal, exact, percent or shares")
+	}
+
+	totalCents := int64(math.Round(total * 100))
+	cents := make([]int64, len(participants))
+	assigned := int64(0)
+	for i, share := range raw {
+		cents[i] = int64(math.Floor(share*100 + 1e-6))
+		assigned += cents[i]
+	}
+	for i := 0; assigned < totalCents; i = (i + 1) % len(cents) {
+		cents[i]++
+		assigned++
+	}
+
+	shares := make(map[string]float64, len(participants))
+	for i, member := range participants {
+		shares[member] = float64(cents[i]) / 100
+	}
+	return shares, nil
+}
+
+func containsValue(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func occurrenceKey(recurringID primitive.ObjectID, at time.Time, memberID string) string {
+	return recurringID.Hex() + "/" + at.UTC().Format(time.RFC3339) + "/" + memberID
+}
+
+// findException returns the exception recorded for an occurrence, if any
+func findException(template models.RecurringExpense, at time.Time) *models.RecurringException {
+	for i, exception := range template.Exceptions {
+		if exception.Occurrence_At.Equal(at) {
+			return &template.Exceptions[i]
+		}
+	}
+	return nil
+}
+
+// OccurrenceTransactions builds the transactions of one occurrence: the payer
+// paying each other participant's share
+func OccurrenceTransactions(trip models.Trip, template models.RecurringExpense, at time.Time) ([]models.Transaction, error) {
+	amountText := *template.Amount
+	description := *template.Description
+	if exception := findException(template, at); exception != nil {
+		if exception.Skip {
+			return nil, nil
+		}
+		if exception.Amount != nil {
+			amountText = *exception.Amount
+		}
+		if exception.Description != nil {
+			description = *exception.Description
+		}
+	}
+	total, err := strconv.ParseFloat(amountText, 64)
+	if err != nil || total <= 0 {
+		return nil, fmt.Errorf("invalid amount %q", amountText)
+	}
+	shares, err := ComputeSplit(total, template.Participants, *template.Split_Rule, template.Split_Values)
+	if err != nil {
+		return nil, err
+	}
+
+	payer := FindTripMember(trip, *template.Paid_By)
+	if payer == nil {
+		return nil, fmt.Errorf("payer is no longer a member of the trip")
+	}
+	recurringID := template.ID.Hex()
+	transactionType := "Paid"
+	isDeleted := false
+
+	transactions := make([]models.Transaction, 0, len(template.Participants))
+	for _, memberID := range template.Participants {
+		if memberID == *payer.Member_ID || shares[memberID] == 0 {
+			continue
+		}
+		participant := FindTripMember(trip, memberID)
+		if participant == nil {
+			return nil, fmt.Errorf("participant %s is no longer a member of the trip", memberID)
+		}
+		amount := strconv.FormatFloat(shares[memberID], 'f', 2, 64)
+		occurrenceAt := at
+		key := occurrenceKey(template.ID, at, memberID)
+		transactions = append(transactions, models.Transaction{
+			ID:             primitive.NewObjectID(),
+			Trip_ID:        template.Trip_ID,
+			PayerName:      payer.Display_Name,
+			Payer_ID:       payer.Member_ID,
+			ReciverName:    participant.Display_Name,
+			Reciver_ID:     participant.Member_ID,
+			Amount:         &amount,
+			Description:    &description,
+			Category:       template.Category,
+			IsDeleted:      &isDeleted,
+			Type:           &transactionType,
+			Created_At:     at,
+			Recurring_ID:   &recurringID,
+			Occurrence_At:  &occurrenceAt,
+			Occurrence_Key: &key,
+			Version:        1,
+		})
+	}
+	return transactions, nil
+}
+
+// materializeOccurrence saves the transactions of one occurrence that don't exist yet
+func materializeOccurrence(ctx context.Context, trip models.Trip, template models.RecurringExpense, at time.Time) (int, error) {
+	transactions, err := OccurrenceTransactions(trip, template, at)
+	if err != nil || len(transactions) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, len(transactions))
+	for i, t := range transactions {
+		keys[i] = *t.Occurrence_Key
+	}
+	existing, err := transactionCollection.Distinct(ctx, "occurrence_key", bson.M{"occurrence_key": bson.M{"$in": keys}})
+	if err != nil {
+		return 0, fmt.Errorf("error checking existing occurrences: %w", err)
+	}
+	done := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		if k, ok := key.(string); ok {
+			done[k] = true
+		}
+	}
+
+	docs := make([]interface{}, 0, len(transactions))
+	for _, t := range transactions {
+		if !done[*t.Occurrence_Key] {
+			docs = append(docs, t)
+		}
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	if _, err := transactionCollection.InsertMany(ctx, docs); err != nil {
+		return 0, fmt.Errorf("error saving occurrence: %w", err)
+	}
+	return len(docs), nil
+}
+
+// MaterializeDueRecurring turns every due occurrence of every active template
+// into transactions. Occurrences are keyed, so running it twice, or twice at
+// the same time, never duplicates an expense.
+func MaterializeDueRecurring(ctx context.Context, now time.Time) (int, error) {
+	cursor, err := recurringExpenseCollection.Find(ctx, bson.M{
+		"is_deleted":  false,
+		"paused":      false,
+		"next_run_at": bson.M{"$lte": now},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching recurring expenses: %w", err)
+	}
+	var templates []models.RecurringExpense
+	if err = cursor.All(ctx, &templates); err != nil {
+		return 0, fmt.Errorf("error decoding recurring expenses: %w", err)
+	}
+
+	created := 0
+	for _, template := range templates {
+		trip, err := FindTrip(ctx, bson.M{"trip_id": *template.Trip_ID, "is_deleted": bson.M{"$ne": true}})
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return created, fmt.Errorf("error fetching trip: %w", err)
+		}
+		// Closed trips take no new expenses, the template catches up if the trip is reopened
+		if CheckTripAcceptsExpenses(trip) != nil {
+			continue
+		}
+
+		for i := 0; i < maxOccurrencesPerRun && template.Next_Run_At != nil && !template.Next_Run_At.After(now); i++ {
+			at := *template.Next_Run_At
+			n, err := materializeOccurrence(ctx, trip, template, at)
+			if err != nil {
+				// One broken template must not hold up the others. It stays at
+				// this occurrence, so the expense isn't lost, and tells the trip.
+				log.Printf("Recurring expense %s at %s: %v", template.ID.Hex(), at, err)
+				if err := recordRecurringFailure(ctx, template, at, err); err != nil {
+					log.Printf("Could not record the failure of recurring expense %s: %v", template.ID.Hex(), err)
+				}
+				break
+			}
+			created += n
+
+			update := bson.M{"$unset": bson.M{"next_run_at": "", "last_error": "", "last_error_at": ""}}
+			next, ok := OccurrenceFrom(template, at.Add(time.Nanosecond))
+			if ok {
+				update = bson.M{"$set": bson.M{"next_run_at": next}, "$unset": bson.M{"last_error": "", "last_error_at": ""}}
+			}
+			result, err := recurringExpenseCollection.UpdateOne(ctx, bson.M{"_id": template.ID, "next_run_at": at}, update)
+			if err != nil {
+				return created, fmt.Errorf("error advancing recurring expense: %w", err)
+			}
+			if result.ModifiedCount == 0 {
+				break // another run moved it on already
+			}
+			if ok {
+				template.Next_Run_At = &next
+			} else {
+				template.Next_Run_At = nil
+			}
+		}
+	}
+	return created, nil
+}
+
+// recordRecurringFailure keeps why an occurrence couldn't be saved on the
+// template. The trip hears about it once, not on every retry.
+func recordRecurringFailure(ctx context.Context, template models.RecurringExpense, at time.Time, cause error) error {
+	message := cause.Error()
+	now := time.Now()
+	_, err := recurringExpenseCollection.UpdateOne(ctx,
+		bson.M{"_id": template.ID, "next_run_at": at},
+		bson.M{"$set": bson.M{"last_error": message, "last_error_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if template.Last_Error != nil && *template.Last_Error == message {
+		return nil
+	}
+	return RecordTripEvent(ctx, *template.Trip_ID, "RECURRING_EXPENSE_FAILED", "", "", map[string]interface{}{
+		"recurring_id":  template.ID.Hex(),
+		"occurrence_at": at,
+		"error":         message,
+	})
+}
+
+// FindRecurringExpense loads a live template of a trip
+func FindRecurringExpense(ctx context.Context, tripID, recurringID string) (models.RecurringExpense, error) {
+	var template models.RecurringExpense
+	objectID, err := primitive.ObjectIDFromHex(recurringID)
+	if err != nil {
+		return template, mongo.ErrNoDocuments
+	}
+	err = recurringExpenseCollection.FindOne(ctx, bson.M{"_id": objectID, "trip_id": tripID, "is_deleted": false}).Decode(&template)
+	return template, err
+}
+
+// SaveRecurringExpense inserts a new template
+func SaveRecurringExpense(ctx context.Context, template models.RecurringExpense) error {
+	_, err := recurringExpenseCollection.InsertOne(ctx, template)
+	return err
+}
+
+// ListRecurringExpenses returns the live templates of a trip
+func ListRecurringExpenses(ctx context.Context, tripID string) ([]models.RecurringExpense, error) {
+	cursor, err := recurringExpenseCollection.Find(ctx, bson.M{"trip_id": tripID, "is_deleted": false})
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]models.RecurringExpense, 0)
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// UpdateRecurringExpense applies an update to a template
+func UpdateRecurringExpense(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	_, err := recurringExpenseCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// SetOccurrenceException skips or changes one occurrence. Occurrences already
+// materialized are updated in place: skipping soft-deletes their transactions,
+// editing rewrites their amounts and description.
+func SetOccurrenceException(ctx context.Context, trip models.Trip, template models.RecurringExpense, exception models.RecurringException) (int, error) {
+	updated := 0
+	err := RunInTransaction(ctx, func(ctx context.Context) error {
+		updated = 0
+		previous := template.Exceptions
+		if _, err := recurringExpenseCollection.UpdateOne(ctx,
+			bson.M{"_id": template.ID},
+			bson.M{"$pull": bson.M{"exceptions": bson.M{"occurrence_at": exception.Occurrence_At}}},
+		); err != nil {
+			return fmt.Errorf("error updating occurrence: %w", err)
+		}
+		OnRollback(ctx, func(ctx context.Context) error {
+			_, err := recurringExpenseCollection.UpdateOne(ctx, bson.M{"_id": template.ID}, bson.M{"$set": bson.M{"exceptions": previous}})
+			return err
+		})
+		if _, err := recurringExpenseCollection.UpdateOne(ctx,
+			bson.M{"_id": template.ID},
+			bson.M{"$push": bson.M{"exceptions": exception}},
+		); err != nil {
+			return fmt.Errorf("error updating occurrence: %w", err)
+		}
+
+		// Only the job stamps an occurrence key, hand-made payments never match
+		filter := bson.M{
+			"recurring_id":   template.ID.Hex(),
+			"occurrence_at":  exception.Occurrence_At,
+			"occurrence_key": bson.M{"$exists": true},
+			"is_deleted":     bson.M{"$ne": true},
+		}
+		if exception.Skip {
+			ids, err := transactionCollection.Distinct(ctx, "_id", filter)
+			if err != nil {
+				return fmt.Errorf("error skipping occurrence: %w", err)
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			result, err := transactionCollection.UpdateMany(ctx,
+				bson.M{"_id": bson.M{"$in": ids}},
+				BumpVersion(bson.M{"$set": bson.M{"is_deleted": true, "deleted_at": time.Now()}}),
+			)
+			if err != nil {
+				return fmt.Errorf("error skipping occurrence: %w", err)
+			}
+			OnRollback(ctx, func(ctx context.Context) error {
+				_, err := transactionCollection.UpdateMany(ctx,
+					bson.M{"_id": bson.M{"$in": ids}},
+					BumpVersion(bson.M{"$set": bson.M{"is_deleted": false}, "$unset": bson.M{"deleted_at": ""}}),
+				)
+				return err
+			})
+			updated = int(result.ModifiedCount)
+			return nil
+		}
+
+		template.Exceptions = []models.RecurringException{exception}
+		transactions, err := OccurrenceTransactions(trip, template, exception.Occurrence_At)
+		if err != nil {
+			return err
+		}
+		for _, t := range transactions {
+			var before models.Transaction
+			err := transactionCollection.FindOne(ctx, bson.M{"occurrence_key": *t.Occurrence_Key, "is_deleted": bson.M{"$ne": true}}).Decode(&before)
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error editing occurrence: %w", err)
+			}
+			result, err := transactionCollection.UpdateOne(ctx,
+				bson.M{"_id": before.ID},
+				BumpVersion(bson.M{"$set": bson.M{"amount": *t.Amount, "description": *t.Description}}),
+			)
+			if err != nil {
+				return fmt.Errorf("error editing occurrence: %w", err)
+			}
+			OnRollback(ctx, func(ctx context.Context) error {
+				_, err := transactionCollection.UpdateOne(ctx,
+					bson.M{"_id": before.ID},
+					BumpVersion(bson.M{"$set": bson.M{"amount": before.Amount, "description": before.Description}}),
+				)
+				return err
+			})
+			updated += int(result.ModifiedCount)
+		}
+		return nil
+	})
+	return updated, err
+}
@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"connection/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) should fail", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	cases := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"first of the month", "0 9 1 * *", date(2026, 1, 15, 10, 0), date(2026, 2, 1, 9, 0)},
+		{"strictly after", "0 9 * * *", date(2026, 1, 15, 9, 0), date(2026, 1, 16, 9, 0)},
+		{"steps and ranges over a weekend", "*/15 8-18 * * 1-5", date(2026, 1, 16, 18, 50), date(2026, 1, 19, 8, 0)},
+		{"list of minutes", "5,35 * * * *", date(2026, 1, 15, 10, 6), date(2026, 1, 15, 10, 35)},
+		{"step from a value", "10/20 * * * *", date(2026, 1, 15, 10, 31), date(2026, 1, 15, 10, 50)},
+		{"sunday as 7", "0 12 * * 7", date(2026, 1, 1, 0, 0), date(2026, 1, 4, 12, 0)},
+		{"sunday as 0", "0 12 * * 0", date(2026, 1, 1, 0, 0), date(2026, 1, 4, 12, 0)},
+		{"dom only", "0 0 13 * *", date(2026, 1, 1, 0, 0), date(2026, 1, 13, 0, 0)},
+		// Both day fields restricted: either may match
+		{"dom or dow, dow first", "0 0 13 * 5", date(2026, 1, 1, 0, 0), date(2026, 1, 2, 0, 0)},
+		{"dom or dow, dom first", "0 0 13 * 5", date(2026, 1, 10, 0, 0), date(2026, 1, 13, 0, 0)},
+		// A starred step leaves the field unrestricted, so both must match
+		{"starred step and dow", "0 0 */10 * 1", date(2026, 1, 1, 0, 0), date(2026, 5, 11, 0, 0)},
+		{"month rollover into the next year", "30 6 * 1 *", date(2026, 2, 1, 0, 0), date(2027, 1, 1, 6, 30)},
+		{"leap day", "0 0 29 2 *", date(2026, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", date(2026, 1, 1, 0, 0), time.Time{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.Next(tc.from); !got.Equal(tc.want) {
+				t.Errorf("Next(%s) of %q = %s, want %s", tc.from, tc.expr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	cases := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{date(2026, 1, 31, 9, 30), 1, date(2026, 2, 28, 9, 30)},
+		{date(2028, 1, 31, 9, 30), 1, date(2028, 2, 29, 9, 30)},
+		{date(2026, 1, 31, 9, 30), 2, date(2026, 3, 31, 9, 30)},
+		{date(2026, 3, 31, 0, 0), 1, date(2026, 4, 30, 0, 0)},
+		{date(2026, 8, 31, 0, 0), 6, date(2027, 2, 28, 0, 0)},
+		{date(2026, 12, 15, 0, 0), 1, date(2027, 1, 15, 0, 0)},
+		{date(2026, 5, 10, 0, 0), 0, date(2026, 5, 10, 0, 0)},
+		{date(2026, 5, 10, 0, 0), 24, date(2028, 5, 10, 0, 0)},
+	}
+	for _, tc := range cases {
+		if got := addMonths(tc.from, tc.months); !got.Equal(tc.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tc.from, tc.months, got, tc.want)
+		}
+	}
+}
+
+func recurringTemplate(frequency string, interval int, start time.Time) models.RecurringExpense {
+	return models.RecurringExpense{Frequency: &frequency, Interval: interval, Start_At: start}
+}
+
+func TestOccurrenceFrom(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+	cron := recurringTemplate("cron", 0, date(2026, 1, 1, 0, 0))
+	expr := "0 9 * * 1"
+	cron.Cron = &expr
+	ending := recurringTemplate("weekly", 1, date(2026, 1, 1, 9, 0))
+	end := date(2026, 1, 10, 0, 0)
+	ending.End_At = &end
+
+	cases := []struct {
+		name     string
+		template models.RecurringExpense
+		from     time.Time
+		want     time.Time
+		ok       bool
+	}{
+		{"before the start", recurringTemplate("daily", 1, date(2026, 1, 5, 9, 0)), date(2026, 1, 1, 0, 0), date(2026, 1, 5, 9, 0), true},
+		{"on an occurrence", recurringTemplate("daily", 2, date(2026, 1, 1, 9, 0)), date(2026, 1, 3, 9, 0), date(2026, 1, 3, 9, 0), true},
+		{"just after an occurrence", recurringTemplate("daily", 2, date(2026, 1, 1, 9, 0)), date(2026, 1, 1, 9, 1), date(2026, 1, 3, 9, 0), true},
+		{"weekly", recurringTemplate("weekly", 2, date(2026, 1, 1, 9, 0)), date(2026, 1, 2, 0, 0), date(2026, 1, 15, 9, 0), true},
+		{"monthly clamps to february", recurringTemplate("monthly", 1, date(2026, 1, 31, 9, 0)), date(2026, 2, 1, 0, 0), date(2026, 2, 28, 9, 0), true},
+		// Every month counts from the start, so the 31st comes back after february
+		{"monthly returns to the 31st", recurringTemplate("monthly", 1, date(2026, 1, 31, 9, 0)), date(2026, 3, 1, 0, 0), date(2026, 3, 31, 9, 0), true},
+		{"every other month", recurringTemplate("monthly", 2, date(2026, 1, 15, 9, 0)), date(2026, 1, 16, 0, 0), date(2026, 3, 15, 9, 0), true},
+		{"cron at or after", cron, date(2026, 1, 5, 9, 0), date(2026, 1, 5, 9, 0), true},
+		{"cron later", cron, date(2026, 1, 5, 9, 1), date(2026, 1, 12, 9, 0), true},
+		{"past the end", ending, date(2026, 1, 9, 0, 0), date(2026, 1, 15, 9, 0), false},
+		{"before the end", ending, date(2026, 1, 2, 0, 0), date(2026, 1, 8, 9, 0), true},
+		// A day is 23 or 25 hours across a DST change
+		{"spring forward", recurringTemplate("daily", 1, time.Date(2026, 3, 28, 9, 0, 0, 0, berlin)), time.Date(2026, 3, 29, 9, 30, 0, 0, berlin), time.Date(2026, 3, 30, 9, 0, 0, 0, berlin), true},
+		{"fall back", recurringTemplate("daily", 1, time.Date(2026, 10, 24, 9, 0, 0, 0, berlin)), time.Date(2026, 10, 25, 8, 30, 0, 0, berlin), time.Date(2026, 10, 25, 9, 0, 0, 0, berlin), true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := OccurrenceFrom(tc.template, tc.from)
+			if !got.Equal(tc.want) || ok != tc.ok {
+				t.Errorf("OccurrenceFrom(%s) = %s, %v, want %s, %v", tc.from, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestComputeSplit(t *testing.T) {
+	abc := []string{"a", "b", "c"}
+	cases := []struct {
+		name   string
+		total  float64
+		people []string
+		rule   string
+		values map[string]float64
+		want   map[string]float64
+	}{
+		{"equal thirds", 100, abc, "equal", nil, map[string]float64{"a": 33.34, "b": 33.33, "c": 33.33}},
+		{"default rule is equal", 10, []string{"a", "b"}, "", nil, map[string]float64{"a": 5, "b": 5}},
+		{"one cent", 0.01, abc, "equal", nil, map[string]float64{"a": 0.01, "b": 0, "c": 0}},
+		{"two left-over cents", 0.05, abc, "equal", nil, map[string]float64{"a": 0.02, "b": 0.02, "c": 0.01}},
+		{"exact", 0.3, []string{"a", "b"}, "exact", map[string]float64{"a": 0.1, "b": 0.2}, map[string]float64{"a": 0.1, "b": 0.2}},
+		{"exact within half a cent", 10, []string{"a", "b"}, "exact", map[string]float64{"a": 5.004, "b": 4.999}, map[string]float64{"a": 5.01, "b": 4.99}},
+		{"percent", 10.01, []string{"a", "b"}, "percent", map[string]float64{"a": 50, "b": 50}, map[string]float64{"a": 5.01, "b": 5}},
+		{"shares", 10, []string{"a", "b"}, "shares", map[string]float64{"a": 1, "b": 2}, map[string]float64{"a": 3.34, "b": 6.66}},
+		{"zero share", 10, []string{"a", "b"}, "shares", map[string]float64{"a": 1}, map[string]float64{"a": 10, "b": 0}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ComputeSplit(tc.total, tc.people, tc.rule, tc.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for member, want := range tc.want {
+				if math.Abs(got[member]-want) > 1e-9 {
+					t.Errorf("%s gets %.2f, want %.2f", member, got[member], want)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeSplitRejects(t *testing.T) {
+	ab := []string{"a", "b"}
+	cases := []struct {
+		name   string
+		people []string
+		rule   string
+		values map[string]float64
+	}{
+		{"no participants", nil, "equal", nil},
+		{"unknown rule", ab, "random", nil},
+		{"value for an outsider", ab, "exact", map[string]float64{"a": 5, "b": 3, "c": 2}},
+		{"exact off by a cent", ab, "exact", map[string]float64{"a": 5, "b": 4.99}},
+		{"negative exact amount", ab, "exact", map[string]float64{"a": 15, "b": -5}},
+		{"percent not 100", ab, "percent", map[string]float64{"a": 50, "b": 40}},
+		{"negative share", ab, "shares", map[string]float64{"a": 3, "b": -1}},
+		{"no shares", ab, "shares", map[string]float64{}},
+	}
+	for _, tc := range cases {
+		if _, err := ComputeSplit(10, tc.people, tc.rule, tc.values); err == nil {
+			t.Errorf("%s: ComputeSplit should fail", tc.name)
+		}
+	}
+}
+
+func TestComputeSplitAddsUpToTotal(t *testing.T) {
+	people := []string{"a", "b", "c", "d", "e", "f", "g"}
+	values := map[string]float64{"a": 1, "b": 2, "c": 3, "d": 5, "e": 7, "f": 11, "g": 13}
+	for cents := int64(1); cents < 5000; cents += 37 {
+		total := float64(cents) / 100
+		for _, rule := range []string{"equal", "shares"} {
+			ruleValues := values
+			if rule == "equal" {
+				ruleValues = nil
+			}
+			shares, err := ComputeSplit(total, people, rule, ruleValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := int64(0)
+			for _, share := range shares {
+				if share < 0 {
+					t.Fatalf("%s split of %.2f has a negative share", rule, total)
+				}
+				sum += int64(math.Round(share * 100))
+			}
+			if sum != cents {
+				t.Errorf("%s split of %.2f adds up to %d cents", rule, total, sum)
+			}
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package helpers
+
+import (
+	"connection/database"
+	"connection/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reminderPreferenceCollection *mongo.Collection = database.OpenCollection(database.Client, "reminder_preferences")
+var nudgeCollection *mongo.Collection = database.OpenCollection(database.Client, "nudges")
+
+// Reminder modes of a trip
+const (
+	ReminderOff      = "off"
+	ReminderWeekly   = "weekly"
+	ReminderAfterEnd = "after_end"
+)
+
+// Actions a reminder link can carry
+const (
+	ReminderActionSnooze      = "snooze"
+	ReminderActionUnsubscribe = "unsubscribe"
+)
+
+// ReminderInterval is how often a trip's debtors are reminded
+const ReminderInterval = 7 * 24 * time.Hour
+
+// ReminderSnoozeDays is how long a snooze link mutes reminders by default
+const ReminderSnoozeDays = 7
+
+// reminderLinkLifetime is how long the links of a reminder email keep working
+const reminderLinkLifetime = 60 * 24 * time.Hour
+
+var ErrInvalidReminderToken = errors.New("Invalid or expired link")
+
+// NudgeCooldown is how long a creditor has to wait before nudging the same
+// debtor again
+func NudgeCooldown() time.Duration {
+	hours, err := strconv.Atoi(getEnv("NUDGE_COOLDOWN_HOURS", "24"))
+	if err != nil || hours < 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// ValidReminderMode tells whether mode is one of the reminder modes
+func ValidReminderMode(mode string) bool {
+	return mode == ReminderOff || mode == ReminderWeekly || mode == ReminderAfterEnd
+}
+
+func reminderSecret() []byte {
+	return []byte(getEnv("REMINDER_SECRET", SECRET_KEY))
+}
+
+func reminderSignature(payload string) string {
+	mac := hmac.New(sha256.New, reminderSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ReminderToken signs an action on the reminders of a trip for a user, so the
+// links in an email work without logging in
+func ReminderToken(action, uid, tripID string, expires time.Time) string {
+	payload := strings.Join([]string{action, uid, tripID, strconv.FormatInt(expires.Unix(), 10)}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + reminderSignature(encoded)
+}
+
+// ParseReminderToken checks a token made by ReminderToken and returns what it was signed for
+func ParseReminderToken(token string) (action, uid, tripID string, err error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(reminderSignature(encoded))) {
+		return "", "", "", ErrInvalidReminderToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", "", ErrInvalidReminderToken
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return "", "", "", ErrInvalidReminderToken
+	}
+	expires, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", "", "", ErrInvalidReminderToken
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// reminderLink is the public URL that applies action to the user's reminders of a trip
+func reminderLink(action, uid, tripID string) string {
+	token := ReminderToken(action, uid, tripID, time.Now().Add(reminderLinkLifetime))
+	base := strings.TrimRight(getEnv("APP_BASE_URL", ""), "/")
+	return base + "/reminders/" + action + "?token=" + url.QueryEscape(token)
+}
+
+// RemindersMuted tells whether the user snoozed or unsubscribed from the
+// reminders of a trip, or from reminders altogether
+func RemindersMuted(ctx context.Context, uid, tripID string, now time.Time) (bool, error) {
+	cursor, err := reminderPreferenceCollection.Find(ctx, bson.M{
+		"uid":     uid,
+		"trip_id": bson.M{"$in": bson.A{tripID, ""}},
+	})
+	if err != nil {
+		return false, err
+	}
+	var preferences []models.ReminderPreference
+	if err := cursor.All(ctx, &preferences); err != nil {
+		return false, err
+	}
+	for _, preference := range preferences {
+		if preference.Unsubscribed != nil && *preference.Unsubscribed {
+			return true, nil
+		}
+		if preference.Snoozed_Until != nil && preference.Snoozed_Until.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func setReminderPreference(ctx context.Context, uid, tripID string, set bson.M) error {
+	set["updated_at"] = time.Now()
+	_, err := reminderPreferenceCollection.UpdateOne(ctx,
+		bson.M{"uid": uid, "trip_id": tripID},
+		bson.M{
+			"$set":         set,
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// SnoozeReminders mutes the user's reminders of a trip until the given time
+func SnoozeReminders(ctx context.Context, uid, tripID string, until time.Time) error {
+	return setReminderPreference(ctx, uid, tripID, bson.M{"snoozed_until": until})
+}
+
+// UnsubscribeReminders stops the user's reminders of a trip, or of every trip
+// when tripID is empty
+func UnsubscribeReminders(ctx context.Context, uid, tripID string) error {
+	return setReminderPreference(ctx, uid, tripID, bson.M{"unsubscribed": true})
+}
+
+// ReminderDue tells whether the debtors of a trip should be reminded now
+func ReminderDue(trip models.Trip, now time.Time) bool {
+	settings := trip.Reminders
+	if settings == nil || settings.Mode == nil {
+		return false
+	}
+	switch *settings.Mode {
+	case ReminderWeekly:
+	case ReminderAfterEnd:
+		if trip.End_Date == nil {
+			return false
+		}
+		days := 0
+		if settings.Days_After_End != nil {
+			days = *settings.Days_After_End
+		}
+		if now.Before(trip.End_Date.AddDate(0, 0, days)) {
+			return false
+		}
+	default:
+		return false
+	}
+	return settings.Last_Sent_At == nil || !now.Before(settings.Last_Sent_At.Add(ReminderInterval))
+}
+
+// TransfersByDebtor groups the settlements of a trip by the member who has to pay
+func TransfersByDebtor(settlements []Settlement) map[string][]Settlement {
+	transfers := make(map[string][]Settlement)
+	for _, s := range settlements {
+		if s.From_ID == "" {
+			continue
+		}
+		transfers[s.From_ID] = append(transfers[s.From_ID], s)
+	}
+	return transfers
+}
+
+// reminderEmail writes the email telling a debtor what they still have to pay
+func reminderEmail(trip models.Trip, member models.TripMember, transfers []Settlement, intro string) (subject, body string) {
+	tripName := "your trip"
+	if trip.Name != nil {
+		tripName = *trip.Name
+	}
+	currency := TripCurrency(trip)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n%s\n\n", *member.Display_Name, intro)
+	total := 0.0
+	for _, t := range transfers {
+		fmt.Fprintf(&b, "  %.2f %s to %s\n", t.Amount, currency, t.To)
+		total += t.Amount
+	}
+	fmt.Fprintf(&b, "\nTotal: %.2f %s\n\n", total, currency)
+	fmt.Fprintf(&b, "Snooze these reminders for %d days: %s\n", ReminderSnoozeDays, reminderLink(ReminderActionSnooze, *member.Uid, *trip.Trip_ID))
+	fmt.Fprintf(&b, "Stop reminders for this trip: %s\n", reminderLink(ReminderActionUnsubscribe, *member.Uid, *trip.Trip_ID))
+
+	return "Settle up for " + tripName, b.String()
+}
+
+// SendTransferReminder emails a linked member the transfers they still owe
+func SendTransferReminder(ctx context.Context, trip models.Trip, member models.TripMember, transfers []Settlement, intro string) error {
+	if member.Uid == nil {
+		return fmt.Errorf("member is not linked to a user")
+	}
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": *member.Uid}).Decode(&user); err != nil {
+		return fmt.Errorf("error fetching user: %w", err)
+	}
+	if user.Email == nil || *user.Email == "" || (user.IsDeleted != nil && *user.IsDeleted) {
+		return fmt.Errorf("user has no email address")
+	}
+
+	subject, body := reminderEmail(trip, member, transfers, intro)
+	return SendEmail(*user.Email, subject, body)
+}
+
+// SendDueReminders emails the debtors of every trip whose reminder is due
+func SendDueReminders(ctx context.Context) (int, error) {
+	now := time.Now()
+	var trips []models.Trip
+	cursor, err := tripCollection.Find(ctx, bson.M{
+		"reminders.mode": bson.M{"$in": bson.A{ReminderWeekly, ReminderAfterEnd}},
+		"is_deleted":     bson.M{"$ne": true},
+		"status":         bson.M{"$ne": TripArchived},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching trips with reminders: %w", err)
+	}
+	if err = cursor.All(ctx, &trips); err != nil {
+		return 0, fmt.Errorf("error decoding trips with reminders: %w", err)
+	}
+
+	sent := 0
+	for _, trip := range trips {
+		if trip.Trip_ID == nil || !ReminderDue(trip, now) {
+			continue
+		}
+		transactions, err := TripTransactions(ctx, *trip.Trip_ID)
+		if err != nil {
+			return sent, fmt.Errorf("error fetching transactions: %w", err)
+		}
+
+		for memberID, transfers := range TransfersByDebtor(CalculateSettlements(transactions)) {
+			member := FindTripMember(trip, memberID)
+			if member == nil || member.Uid == nil {
+				continue
+			}
+			muted, err := RemindersMuted(ctx, *member.Uid, *trip.Trip_ID, now)
+			if err != nil {
+				return sent, fmt.Errorf("error fetching reminder preferences: %w", err)
+			}
+			if muted {
+				continue
+			}
+			// One bad address shouldn't hold up everyone else's reminders
+			if err := SendTransferReminder(ctx, trip, *member, transfers, "You still have transfers pending to settle this trip:"); err != nil {
+				log.Printf("Reminder to member %s of trip %s failed: %v", memberID, *trip.Trip_ID, err)
+				continue
+			}
+			sent++
+		}
+
+		// Bookkeeping of the job, not an edit clients need to reload for, so
+		// the version stays put
+		_, err = tripCollection.UpdateOne(ctx,
+			bson.M{"trip_id": *trip.Trip_ID},
+			bson.M{"$set": bson.M{"reminders.last_sent_at": now}},
+		)
+		if err != nil {
+			return sent, fmt.Errorf("error updating reminder schedule: %w", err)
+		}
+	}
+	return sent, nil
+}
+
+// ClaimNudge takes the slot for one member to nudge another, when the last
+// nudge is older than the cooldown. The check and the claim are one upsert,
+// guarded by the unique index on the pair, so concurrent or retried requests
+// can't both get it. A refused claim returns when the slot was last taken.
+// The previous time is what ReleaseNudge puts back.
+func ClaimNudge(ctx context.Context, tripID, fromMemberID, toMemberID string, now time.Time) (claimed bool, previous *time.Time, err error) {
+	pair := bson.M{"trip_id": tripID, "from_member_id": fromMemberID, "to_member_id": toMemberID}
+	filter := bson.M{"sent_at": bson.M{"$lte": now.Add(-NudgeCooldown())}}
+	for field, value := range pair {
+		filter[field] = value
+	}
+
+	var before models.Nudge
+	err = nudgeCollection.FindOneAndUpdate(ctx, filter,
+		bson.M{
+			"$set":         bson.M{"sent_at": now},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return true, nil, nil // first nudge of the pair
+	case err == nil:
+		return true, &before.Sent_At, nil
+	case !mongo.IsDuplicateKeyError(err):
+		return false, nil, err
+	}
+
+	// The pair exists and was nudged within the cooldown
+	var last models.Nudge
+	if err := nudgeCollection.FindOne(ctx, pair).Decode(&last); err != nil {
+		return false, nil, err
+	}
+	return false, &last.Sent_At, nil
+}
+
+// ReleaseNudge gives back a slot taken by ClaimNudge whose email wasn't sent
+func ReleaseNudge(ctx context.Context, tripID, fromMemberID, toMemberID string, claimedAt time.Time, previous *time.Time) error {
+	filter := bson.M{"trip_id": tripID, "from_member_id": fromMemberID, "to_member_id": toMemberID, "sent_at": claimedAt}
+	if previous == nil {
+		_, err := nudgeCollection.DeleteOne(ctx, filter)
+		return err
+	}
+	_, err := nudgeCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"sent_at": *previous}})
+	return err
+}
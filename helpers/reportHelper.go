@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ReportFilter selects the expenses a spending report covers
+type ReportFilter struct {
+	TripID   string
+	From     *time.Time
+	To       *time.Time
+	MemberID string // only what this member consumed, when set
+	Timezone string // used to bucket expenses by day
+	Top      int    // how many of the largest expenses to list
+}
+
+// ReportLine is one bucket of a spending report
+type ReportLine struct {
+	Key   string  `bson:"_id" json:"key"`
+	Name  string  `bson:"name,omitempty" json:"name,omitempty"`
+	Total float64 `bson:"total" json:"total"`
+	Count int     `bson:"count" json:"count"`
+}
+
+// ReportExpense is one of the largest expenses of a report
+type ReportExpense struct {
+	Transaction_ID string    `bson:"_id" json:"transaction_id"`
+	Payer          string    `bson:"payername" json:"payer_name"`
+	Consumer       string    `bson:"recivername" json:"reciever_name"`
+	Description    string    `bson:"description" json:"description"`
+	Category       string    `bson:"category" json:"category"`
+	Amount         float64   `bson:"value" json:"amount"`
+	Created_At     time.Time `bson:"created_at" json:"created_at"`
+}
+
+// SpendingReport is a trip's spending broken down every way we report on
+type SpendingReport struct {
+	Total       float64         `json:"total"`
+	Count       int             `json:"count"`
+	By_Category []ReportLine    `bson:"by_category" json:"by_category"`
+	By_Payer    []ReportLine    `bson:"by_payer" json:"by_payer"`
+	By_Consumer []ReportLine    `bson:"by_consumer" json:"by_consumer"`
+	By_Day      []ReportLine    `bson:"by_day" json:"by_day"`
+	Largest     []ReportExpense `bson:"largest" json:"largest"`
+	Totals      []ReportLine    `bson:"totals" json:"-"`
+}
+
+// TripSpendingReport aggregates the expenses of a trip in a single pipeline.
+// Settlements are not spending and are left out.
+func TripSpendingReport(ctx context.Context, filter ReportFilter) (SpendingReport, error) {
+	var report SpendingReport
+
+	match := bson.M{
+		"trip_id":    filter.TripID,
+		"is_deleted": bson.M{"$ne": true},
+		"type":       "Paid",
+	}
+	if filter.From != nil || filter.To != nil {
+		createdAt := bson.M{}
+		if filter.From != nil {
+			createdAt["$gte"] = *filter.From
+		}
+		if filter.To != nil {
+			createdAt["$lt"] = *filter.To
+		}
+		match["created_at"] = createdAt
+	}
+	if filter.MemberID != "" {
+		match["reciver_id"] = filter.MemberID
+	}
+	if filter.Timezone == "" {
+		filter.Timezone = "UTC"
+	}
+	if filter.Top <= 0 {
+		filter.Top = 5
+	}
+
+	sumBy := func(key interface{}, name interface{}) bson.A {
+		group := bson.M{
+			"_id":   key,
+			"total": bson.M{"$sum": "$value"},
+			"count": bson.M{"$sum": 1},
+		}
+		if name != nil {
+			group["name"] = bson.M{"$last": name}
+		}
+		return bson.A{
+			bson.M{"$group": group},
+			bson.M{"$sort": bson.M{"total": -1}},
+		}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		// Amounts are stored as strings
+		bson.M{"$addFields": bson.M{"value": bson.M{"$convert": bson.M{
+			"input": "$amount", "to": "double", "onError": 0.0, "onNull": 0.0,
+		}}}},
+		bson.M{"$facet": bson.M{
+			"totals":      sumBy(nil, nil),
+			"by_category": sumBy(bson.M{"$ifNull": bson.A{"$category", Uncategorized}}, nil),
+			"by_payer":    sumBy(bson.M{"$ifNull": bson.A{"$payer_id", "$payername"}}, "$payername"),
+			"by_consumer": sumBy(bson.M{"$ifNull": bson.A{"$reciver_id", "$recivername"}}, "$recivername"),
+			"by_day": bson.A{
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateToString": bson.M{
+						"format":   "%Y-%m-%d",
+						"date":     "$created_at",
+						"timezone": filter.Timezone,
+					}},
+					"total": bson.M{"$sum": "$value"},
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"largest": bson.A{
+				bson.M{"$sort": bson.M{"value": -1}},
+				bson.M{"$limit": filter.Top},
+				bson.M{"$project": bson.M{
+					"_id":         bson.M{"$toString": "$_id"},
+					"payername":   1,
+					"recivername": 1,
+					"description": 1,
+					"category":    bson.M{"$ifNull": bson.A{"$category", Uncategorized}},
+					"value":       1,
+					"created_at":  1,
+				}},
+			},
+		}},
+	}
+
+	cursor, err := transactionCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return report, fmt.Errorf("error aggregating transactions: %w", err)
+	}
+	var results []SpendingReport
+	if err = cursor.All(ctx, &results); err != nil {
+		return report, fmt.Errorf("error decoding report: %w", err)
+	}
+	if len(results) > 0 {
+		report = results[0]
+	}
+	if len(report.Totals) > 0 {
+		report.Total = report.Totals[0].Total
+		report.Count = report.Totals[0].Count
+	}
+	return report, nil
+}
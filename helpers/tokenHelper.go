@@ -7,6 +7,7 @@ import (
 	"errors"
 	"log"
 	"os"
+	"testing"
 	"time"
 
 	// "github.com/dgrijalva/jwt-go"
@@ -32,6 +33,9 @@ var SECRET_KEY string
 
 func init() {
 	SECRET_KEY = os.Getenv("SECRET_KEY")
+	if SECRET_KEY == "" && testing.Testing() {
+		SECRET_KEY = "test-secret-key"
+	}
 	if SECRET_KEY == "" {
 		log.Fatal("SECRET_KEY environment variable is not set")
 	}
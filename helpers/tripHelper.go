@@ -13,49 +13,37 @@ import (
 	// "github.com/gin-gonic/gin"
 	"math"
 	"sort"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var linkedMemberCollection *mongo.Collection = database.OpenCollection(database.Client, "LinkedMembers")
+var tripCollection *mongo.Collection = database.OpenCollection(database.Client, "trips")
+var transactionCollection *mongo.Collection = database.OpenCollection(database.Client, "transaction")
 
-func GetAllFreeMembers(Trip_Id string, Members []string) (FreeMembers []string, NotFree []string) {
+func GetAllFreeMembers(trip models.Trip) (FreeMembers []models.TripMember, NotFree []models.TripMember) {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 	defer cancel()
 
-	// Find all linked members for this trip
-	matchStage := bson.D{
-		{"$match", bson.D{
-			{"trip_id", Trip_Id},
-		}},
+	var members []models.TripMember
+	if trip.Member_List != nil {
+		members = *trip.Member_List
 	}
 
-	cursor, err := linkedMemberCollection.Aggregate(ctx, mongo.Pipeline{matchStage})
+	// Find all linked members for this trip
+	linked, err := LinkedMemberIDs(ctx, trip)
 	if err != nil {
 		fmt.Printf("Error finding linked members: %v\n", err)
-		return Members, []string{} // If error, consider all members as free
-	}
-
-	var results []bson.M
-	if err := cursor.All(ctx, &results); err != nil {
-		fmt.Printf("Error decoding linked members: %v\n", err)
-		return Members, []string{} // If error, consider all members as free
-	}
-
-	// Create a map of linked member names
-	linked := make(map[string]bool)
-	for _, doc := range results {
-		if name, ok := doc["name"].(string); ok {
-			linked[name] = true
-		}
+		return members, []models.TripMember{} // If error, consider all members as free
 	}
 
 	// Separate members into free and not free
-	var freeMembers []string
-	var notFree []string
-	for _, m := range Members {
-		if !linked[m] {
+	freeMembers := make([]models.TripMember, 0)
+	notFree := make([]models.TripMember, 0)
+	for _, m := range members {
+		if m.Member_ID == nil || !linked[*m.Member_ID] {
 			freeMembers = append(freeMembers, m)
 		} else {
 			notFree = append(notFree, m)
@@ -66,16 +54,54 @@ func GetAllFreeMembers(Trip_Id string, Members []string) (FreeMembers []string,
 }
 
 type Settlement struct {
-	From   string  `json:"from"`
-	To     string  `json:"to"`
-	Amount float64 `json:"amount"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	From_ID string  `json:"from_id,omitempty"`
+	To_ID   string  `json:"to_id,omitempty"`
+	Amount  float64 `json:"amount"`
 }
 
-func CalculateSettlements(transactions []models.Transaction) []Settlement {
-	// Create a map to store net balances for each person
-	balances := make(map[string]float64)
+// memberKey identifies one side of a transaction by member id, or by name for
+// transactions recorded before member ids existed
+func memberKey(memberID *string, name string) string {
+	if memberID != nil {
+		return *memberID
+	}
+	return "name:" + name
+}
+
+// keyID turns a memberKey back into a member id, empty for name keys
+func keyID(key string) string {
+	if strings.HasPrefix(key, "name:") {
+		return ""
+	}
+	return key
+}
+
+// TripTransactions returns every transaction of a trip that hasn't been deleted
+func TripTransactions(ctx context.Context, tripID string) ([]models.Transaction, error) {
+	filter := bson.M{
+		"trip_id":    tripID,
+		"is_deleted": bson.M{"$ne": true},
+	}
+	cursor, err := transactionCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]models.Transaction, 0)
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// MemberBalances works out the net balance of everyone in the transactions,
+// keyed by member id (or "name:<name>" for transactions without ids), along
+// with the latest name seen for each key
+func MemberBalances(transactions []models.Transaction) (balances map[string]float64, names map[string]string) {
+	balances = make(map[string]float64)
+	names = make(map[string]string)
 
-	// Calculate net balance for each person
 	for _, t := range transactions {
 		// Skip if any required field is nil
 		if t.PayerName == nil || t.ReciverName == nil || t.Amount == nil || t.Type == nil {
@@ -87,10 +113,24 @@ func CalculateSettlements(transactions []models.Transaction) []Settlement {
 			continue // Skip if amount can't be parsed
 		}
 
-		balances[*t.PayerName] -= amount
-		balances[*t.ReciverName] += amount
-
+		payer := memberKey(t.Payer_ID, *t.PayerName)
+		reciver := memberKey(t.Reciver_ID, *t.ReciverName)
+		balances[payer] -= amount
+		balances[reciver] += amount
+		names[payer] = *t.PayerName
+		names[reciver] = *t.ReciverName
 	}
+	return balances, names
+}
+
+// MemberBalance picks a single member's net balance out of MemberBalances
+func MemberBalance(balances map[string]float64, member models.TripMember) float64 {
+	return balances[memberKey(member.Member_ID, *member.Display_Name)]
+}
+
+func CalculateSettlements(transactions []models.Transaction) []Settlement {
+	// Net balance for each person
+	balances, names := MemberBalances(transactions)
 
 	// Separate debtors and creditors
 	var debtors []struct {
@@ -136,9 +176,11 @@ func CalculateSettlements(transactions []models.Transaction) []Settlement {
 		amount := math.Min(debtor.amount, creditor.amount)
 		if amount > 0.01 { // Only create settlement if amount is significant
 			settlements = append(settlements, Settlement{
-				From:   debtor.name,
-				To:     creditor.name,
-				Amount: amount,
+				From:    names[debtor.name],
+				To:      names[creditor.name],
+				From_ID: keyID(debtor.name),
+				To_ID:   keyID(creditor.name),
+				Amount:  amount,
 			})
 		}
 
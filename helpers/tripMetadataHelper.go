@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Phases of a trip relative to its dates
+const (
+	TripUpcoming = "upcoming"
+	TripOngoing  = "ongoing"
+	TripPast     = "past"
+)
+
+// CoverImageTypes are the sniffed content types accepted as a trip cover
+var CoverImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+var ErrInvalidTripDate = errors.New("Dates must be a day (2025-01-31) or an RFC 3339 timestamp")
+
+// TripLocation is the timezone the trip's dates are read in, UTC unless set
+func TripLocation(trip models.Trip) *time.Location {
+	if trip.Timezone != nil {
+		if location, err := time.LoadLocation(*trip.Timezone); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// ParseTripDate reads a trip date as the start of that day in the trip's timezone.
+// Timestamps are accepted too and cut down to their day.
+func ParseTripDate(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidTripDate
+	}
+	return StartOfTripDay(t, location), nil
+}
+
+// StartOfTripDay is midnight of the day t falls on in the given timezone
+func StartOfTripDay(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
+
+// TripPhase tells whether a trip is upcoming, ongoing or past at the given
+// time. The end date counts as a whole day. Trips without dates have no phase.
+func TripPhase(trip models.Trip, now time.Time) string {
+	if trip.Start_Date == nil && trip.End_Date == nil {
+		return ""
+	}
+	if trip.Start_Date != nil && now.Before(*trip.Start_Date) {
+		return TripUpcoming
+	}
+	if trip.End_Date != nil && !now.Before(trip.End_Date.AddDate(0, 0, 1)) {
+		return TripPast
+	}
+	return TripOngoing
+}
+
+// SaveTripCover stores a new cover image for the trip and drops the old one.
+// With an expected version it fails with ErrStaleVersion when the trip was
+// changed since.
+func SaveTripCover(ctx context.Context, trip models.Trip, filename, contentType string, data []byte, uploadedBy string, expected *int64) (models.Attachment, error) {
+	store, err := Blobs()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	attachmentID := primitive.NewObjectID().Hex()
+	key := "trips/" + *trip.Trip_ID + "/cover/" + attachmentID
+	cover := models.Attachment{
+		Attachment_ID: &attachmentID,
+		Key:           &key,
+		Filename:      &filename,
+		Content_Type:  &contentType,
+		Size:          int64(len(data)),
+		Uploaded_By:   &uploadedBy,
+		Uploaded_At:   time.Now(),
+	}
+
+	if err := store.Put(ctx, key, data, contentType); err != nil {
+		return cover, fmt.Errorf("error storing cover image: %w", err)
+	}
+	result, err := tripCollection.UpdateOne(ctx,
+		WithVersion(bson.M{"trip_id": *trip.Trip_ID}, expected),
+		BumpVersion(bson.M{"$set": bson.M{"cover_image": cover}}),
+	)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrStaleVersion
+	}
+	if err != nil {
+		if deleteErr := store.Delete(ctx, key); deleteErr != nil {
+			log.Printf("Could not remove orphaned cover image %s: %v", key, deleteErr)
+		}
+		if err == ErrStaleVersion {
+			return cover, err
+		}
+		return cover, fmt.Errorf("error saving cover image: %w", err)
+	}
+
+	if trip.Cover_Image != nil && trip.Cover_Image.Key != nil {
+		if err := store.Delete(ctx, *trip.Cover_Image.Key); err != nil {
+			log.Printf("Could not remove old cover image %s: %v", *trip.Cover_Image.Key, err)
+		}
+	}
+	return cover, nil
+}
+
+// DeleteTripCover removes the trip's cover image. With an expected version it
+// fails with ErrStaleVersion when the trip was changed since.
+func DeleteTripCover(ctx context.Context, trip models.Trip, expected *int64) error {
+	if trip.Cover_Image == nil {
+		return nil
+	}
+	result, err := tripCollection.UpdateOne(ctx,
+		WithVersion(bson.M{"trip_id": *trip.Trip_ID}, expected),
+		BumpVersion(bson.M{"$unset": bson.M{"cover_image": ""}}),
+	)
+	if err != nil {
+		return fmt.Errorf("error removing cover image: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrStaleVersion
+	}
+	if trip.Cover_Image.Key == nil {
+		return nil
+	}
+	store, err := Blobs()
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, *trip.Cover_Image.Key)
+}
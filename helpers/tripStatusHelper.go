@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"connection/models"
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Lifecycle states of a trip
+const (
+	TripPlanning = "planning"
+	TripActive   = "active"
+	TripSettling = "settling"
+	TripClosed   = "closed"
+	TripArchived = "archived"
+)
+
+// tripStatusTransitions lists the states a trip can move to from each state
+var tripStatusTransitions = map[string][]string{
+	TripPlanning: {TripActive, TripClosed},
+	TripActive:   {TripPlanning, TripSettling, TripClosed},
+	TripSettling: {TripActive, TripClosed},
+	TripClosed:   {TripSettling, TripArchived},
+	TripArchived: {TripClosed},
+}
+
+var ErrTripArchived = errors.New("This trip is archived and can't be changed")
+var ErrTripClosed = errors.New("This trip is closed to new expenses, only settlements can be recorded")
+
+// ValidTripStatus tells whether status is one of the trip lifecycle states
+func ValidTripStatus(status string) bool {
+	_, ok := tripStatusTransitions[status]
+	return ok
+}
+
+// TripStatus is the lifecycle state of a trip. Trips created before states
+// existed are active.
+func TripStatus(trip models.Trip) string {
+	if trip.Status == nil || *trip.Status == "" {
+		return TripActive
+	}
+	return *trip.Status
+}
+
+// CanTransitionTrip tells whether a trip may move from one state to another
+func CanTransitionTrip(from, to string) bool {
+	for _, next := range tripStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTripWritable rejects any change to an archived trip
+func CheckTripWritable(trip models.Trip) error {
+	if TripStatus(trip) == TripArchived {
+		return ErrTripArchived
+	}
+	return nil
+}
+
+// CheckTripAcceptsExpenses rejects new or removed expenses once a trip is closed
+func CheckTripAcceptsExpenses(trip models.Trip) error {
+	switch TripStatus(trip) {
+	case TripArchived:
+		return ErrTripArchived
+	case TripClosed:
+		return ErrTripClosed
+	}
+	return nil
+}
+
+// FinalBalances snapshots the balance of every member of the trip
+func FinalBalances(trip models.Trip, transactions []models.Transaction) []models.FinalBalance {
+	balances, _ := MemberBalances(transactions)
+	final := make([]models.FinalBalance, 0)
+	if trip.Member_List == nil {
+		return final
+	}
+	for _, member := range *trip.Member_List {
+		final = append(final, models.FinalBalance{
+			Member_ID:    member.Member_ID,
+			Display_Name: member.Display_Name,
+			Balance:      math.Round(MemberBalance(balances, member)*100) / 100,
+		})
+	}
+	return final
+}
+
+// SetTripStatus moves a trip to a new state. Closing stores the final
+// balances, reopening a closed trip drops them again.
+func SetTripStatus(ctx context.Context, trip models.Trip, status string, finalBalances []models.FinalBalance) error {
+	now := time.Now()
+	set := bson.M{"status": status, "status_changed_at": now}
+	update := bson.M{}
+	switch {
+	case status == TripClosed && TripStatus(trip) != TripArchived:
+		set["closed_at"] = now
+		set["final_balances"] = finalBalances
+	case status != TripClosed && status != TripArchived:
+		update["$unset"] = bson.M{"closed_at": "", "final_balances": ""}
+	}
+	update["$set"] = set
+
+	// Guard on the state we checked so two concurrent transitions can't both apply
+	filter := bson.M{"trip_id": *trip.Trip_ID, "status": trip.Status}
+	if trip.Status == nil {
+		filter["status"] = bson.M{"$exists": false}
+	}
+	result, err := tripCollection.UpdateOne(ctx, filter, BumpVersion(update))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("The trip status changed in the meantime, please try again")
+	}
+	OnRollback(ctx, func(ctx context.Context) error {
+		set, unset := bson.M{}, bson.M{}
+		if trip.Status != nil {
+			set["status"] = *trip.Status
+		} else {
+			unset["status"] = ""
+		}
+		if trip.Status_Changed_At != nil {
+			set["status_changed_at"] = *trip.Status_Changed_At
+		} else {
+			unset["status_changed_at"] = ""
+		}
+		if trip.Closed_At != nil {
+			set["closed_at"] = *trip.Closed_At
+		} else {
+			unset["closed_at"] = ""
+		}
+		if trip.Final_Balances != nil {
+			set["final_balances"] = *trip.Final_Balances
+		} else {
+			unset["final_balances"] = ""
+		}
+		undo := bson.M{}
+		if len(set) > 0 {
+			undo["$set"] = set
+		}
+		if len(unset) > 0 {
+			undo["$unset"] = unset
+		}
+		_, err := tripCollection.UpdateOne(ctx, bson.M{"trip_id": *trip.Trip_ID, "status": status}, BumpVersion(undo))
+		return err
+	})
+	return nil
+}
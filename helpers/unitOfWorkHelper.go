@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"connection/database"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Unique indexes that settle races between concurrent writers, declared in
+// the migrations package
+const (
+	LinkedMemberIDIndex  = "trip_id_member_id_unique"
+	LinkedMemberUIDIndex = "trip_id_uid_unique"
+)
+
+// transactionsUnsupported is set once the server turned out to be a
+// standalone mongod, which can't run transactions
+var transactionsUnsupported atomic.Bool
+
+type unitOfWorkKey struct{}
+
+// unitOfWork is the state of one RunInTransaction call
+type unitOfWork struct {
+	transactional bool
+	undo          []func(ctx context.Context) error
+}
+
+// RunInTransaction runs work as a single unit: either all of its writes are
+// kept or none are.
+//
+// On a replica set the work runs in a Mongo transaction, retried on transient
+// conflicts, so work must pass the ctx it is given to every query and may run
+// more than once. On a standalone server the work runs directly and the
+// writes that went through are undone with the functions registered through
+// OnRollback; races are then caught by unique indexes instead.
+//
+// A call inside another unit of work joins it.
+func RunInTransaction(ctx context.Context, work func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		return work(ctx)
+	}
+
+	if !transactionsUnsupported.Load() {
+		err := runTransaction(ctx, work)
+		if !isTransactionsUnsupported(err) {
+			return err
+		}
+		transactionsUnsupported.Store(true)
+		log.Println(">> MongoDB does not support transactions here, falling back to compensating writes")
+	}
+
+	uow := &unitOfWork{}
+	if err := work(context.WithValue(ctx, unitOfWorkKey{}, uow)); err != nil {
+		uow.rollback()
+		return err
+	}
+	return nil
+}
+
+func runTransaction(ctx context.Context, work func(ctx context.Context) error) error {
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		// Every attempt starts from scratch
+		uow := &unitOfWork{transactional: true}
+		return nil, work(context.WithValue(sessionCtx, unitOfWorkKey{}, uow))
+	})
+	return err
+}
+
+// isTransactionsUnsupported tells whether the server refused to start a
+// transaction because it isn't part of a replica set
+func isTransactionsUnsupported(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCodeWithMessage(20, "Transaction numbers") {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "Transaction numbers are only allowed")
+}
+
+// OnRollback registers how to undo a write that just went through, for when
+// the unit of work ctx belongs to fails later on. Inside a transaction the
+// abort takes care of it and undo is never called; outside any unit of work
+// it does nothing.
+func OnRollback(ctx context.Context, undo func(ctx context.Context) error) {
+	if uow, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok && !uow.transactional {
+		uow.undo = append(uow.undo, undo)
+	}
+}
+
+// rollback undoes the writes in reverse order. It uses a fresh context, the
+// one of the work may be what ran out.
+func (uow *unitOfWork) rollback() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for i := len(uow.undo) - 1; i >= 0; i-- {
+		if err := uow.undo[i](ctx); err != nil {
+			log.Printf("Could not roll back a write: %v", err)
+		}
+	}
+}
+
+// IsDuplicateKeyOn tells whether err is a duplicate key error raised by the
+// named unique index
+func IsDuplicateKeyOn(err error, index string) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: "+index+" ")
+}
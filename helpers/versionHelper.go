@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidIfMatch = errors.New("If-Match must be the ETag of the resource, e.g. \"3\"")
+var ErrStaleVersion = errors.New("The resource was changed by someone else, reload it and try again")
+
+// BumpVersion adds the version increment every update of a trip or
+// transaction carries, so clients can tell their copy is stale
+func BumpVersion(update bson.M) bson.M {
+	bumped := make(bson.M, len(update)+1)
+	for operator, fields := range update {
+		bumped[operator] = fields
+	}
+	inc := bson.M{}
+	if existing, ok := update["$inc"].(bson.M); ok {
+		for field, value := range existing {
+			inc[field] = value
+		}
+	}
+	inc["version"] = 1
+	bumped["$inc"] = inc
+	return bumped
+}
+
+// ETag is the entity tag of a document at a version
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ParseIfMatch reads the version an If-Match header expects. An empty header
+// or "*" expects nothing and returns nil.
+func ParseIfMatch(header string) (*int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	tag := strings.TrimPrefix(header, "W/")
+	if unquoted, err := strconv.Unquote(tag); err == nil {
+		tag = unquoted
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 0 {
+		return nil, ErrInvalidIfMatch
+	}
+	return &version, nil
+}
+
+// MatchesVersion tells whether a header value names the given version, the
+// way If-None-Match is compared
+func MatchesVersion(header string, version int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == ETag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithVersion narrows an update filter to the expected version, documents
+// from before versions count as version 0. A nil version leaves it as is.
+func WithVersion(filter bson.M, version *int64) bson.M {
+	if version == nil {
+		return filter
+	}
+	narrowed := make(bson.M, len(filter)+1)
+	for field, value := range filter {
+		narrowed[field] = value
+	}
+	if *version == 0 {
+		narrowed["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		narrowed["version"] = *version
+	}
+	return narrowed
+}
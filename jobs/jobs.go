@@ -0,0 +1,265 @@
+// Package jobs runs background work such as purges and recurring expenses
+// outside of HTTP requests, from a scheduled Lambda event or the command line.
+package jobs
+
+import (
+	"connection/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Func does the work of a job and reports how many items it handled
+type Func func(ctx context.Context) (int, error)
+
+// Job is a named piece of background work
+type Job struct {
+	Name    string
+	Run     Func
+	Timeout time.Duration
+}
+
+// Status is the lock and last run of a job, one document per job
+type Status struct {
+	Name             string     `bson:"_id" json:"name"`
+	Locked_Until     *time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	Locked_By        *string    `bson:"locked_by,omitempty" json:"-"`
+	Last_Started_At  *time.Time `bson:"last_started_at,omitempty" json:"last_started_at,omitempty"`
+	Last_Finished_At *time.Time `bson:"last_finished_at,omitempty" json:"last_finished_at,omitempty"`
+	Last_Status      *string    `bson:"last_status,omitempty" json:"last_status,omitempty"`
+	Last_Error       *string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	Last_Processed   int        `bson:"last_processed" json:"last_processed"`
+	Last_Duration_Ms int64      `bson:"last_duration_ms" json:"last_duration_ms"`
+}
+
+// Result is what one invocation of a job did
+type Result struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // success, failed or skipped
+	Processed int    `json:"processed"`
+	Error     string `json:"error,omitempty"`
+}
+
+var jobCollection *mongo.Collection = database.OpenCollection(database.Client, "jobs")
+
+var registry = map[string]Job{}
+
+// Register adds a job. A timeout of zero means five minutes.
+func Register(name string, timeout time.Duration, run Func) {
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	registry[name] = Job{Name: name, Run: run, Timeout: timeout}
+}
+
+// Names lists the registered jobs in a stable order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// acquire takes the job's lock until its timeout has passed, so a crashed run
+// can't keep it forever. It reports false while another run holds it.
+func acquire(ctx context.Context, job Job, runID string, now time.Time) (bool, error) {
+	lockedUntil := now.Add(job.Timeout)
+	_, err := jobCollection.UpdateOne(ctx,
+		bson.M{
+			"_id": job.Name,
+			"$or": bson.A{
+				bson.M{"locked_until": bson.M{"$exists": false}},
+				bson.M{"locked_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			"locked_until":    lockedUntil,
+			"locked_by":       runID,
+			"last_started_at": now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The document exists and is locked, so the upsert tried to insert
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Run runs one job unless another invocation is already running it, and
+// records how it went
+func Run(ctx context.Context, name string) (Result, error) {
+	job, ok := registry[name]
+	if !ok {
+		return Result{Name: name, Status: "failed"}, fmt.Errorf("unknown job %q", name)
+	}
+
+	runID := primitive.NewObjectID().Hex()
+	started := time.Now()
+	locked, err := acquire(ctx, job, runID, started)
+	if err != nil {
+		return Result{Name: name, Status: "failed"}, fmt.Errorf("error locking job %s: %w", name, err)
+	}
+	if !locked {
+		log.Printf(">> Job %s is already running, skipping", name)
+		return Result{Name: name, Status: "skipped"}, nil
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	processed, runErr := job.Run(jobCtx)
+	cancel()
+
+	result := Result{Name: name, Status: "success", Processed: processed}
+	set := bson.M{
+		"locked_until":     time.Now(),
+		"last_finished_at": time.Now(),
+		"last_status":      "success",
+		"last_processed":   processed,
+		"last_duration_ms": time.Since(started).Milliseconds(),
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"last_error": "", "locked_by": ""}}
+	if runErr != nil {
+		result.Status, result.Error = "failed", runErr.Error()
+		set["last_status"] = "failed"
+		set["last_error"] = runErr.Error()
+		update["$unset"] = bson.M{"locked_by": ""}
+	}
+	// Release with a fresh context: the job's own may have timed out
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer releaseCancel()
+	if _, err := jobCollection.UpdateOne(releaseCtx, bson.M{"_id": name, "locked_by": runID}, update); err != nil {
+		log.Printf(">> Could not record status of job %s: %v", name, err)
+	}
+
+	log.Printf(">> Job %s: %s, %d processed in %s", name, result.Status, processed, time.Since(started))
+	return result, runErr
+}
+
+// RunAll runs the named jobs one after the other, or every registered job
+// when none are named. A failing job doesn't stop the rest.
+func RunAll(ctx context.Context, names []string) ([]Result, error) {
+	if len(names) == 0 {
+		names = Names()
+	}
+	results := make([]Result, 0, len(names))
+	var firstErr error
+	for _, name := range names {
+		result, err := Run(ctx, name)
+		results = append(results, result)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return results, firstErr
+}
+
+// Statuses returns the last run of every registered job
+func Statuses(ctx context.Context) ([]Status, error) {
+	cursor, err := jobCollection.Find(ctx, bson.M{"_id": bson.M{"$in": Names()}})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0)
+	if err := cursor.All(ctx, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// event is the part of a Lambda event that selects jobs. Either the event
+// itself names them ({"job": "expire-otps"}), or it is an EventBridge
+// scheduled event carrying them in its detail. A scheduled event has to name
+// its jobs: running all of them would include migrate and reminders.
+type event struct {
+	Job        string   `json:"job"`
+	Jobs       []string `json:"jobs"`
+	Source     string   `json:"source"`
+	DetailType string   `json:"detail-type"`
+	Detail     struct {
+		Job  string   `json:"job"`
+		Jobs []string `json:"jobs"`
+	} `json:"detail"`
+}
+
+// HandleEvent runs the jobs a Lambda event asks for. It reports false when
+// the event isn't meant for jobs, e.g. an HTTP request.
+func HandleEvent(ctx context.Context, raw json.RawMessage) ([]Result, bool, error) {
+	var e event
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil, false, nil
+	}
+
+	var names []string
+	switch {
+	case e.Job != "":
+		names = []string{e.Job}
+	case len(e.Jobs) > 0:
+		names = e.Jobs
+	case e.Source == "aws.events" || e.DetailType == "Scheduled Event":
+		names = e.Detail.Jobs
+		if e.Detail.Job != "" {
+			names = append(names, e.Detail.Job)
+		}
+		if len(names) == 0 {
+			return nil, true, fmt.Errorf("scheduled event names no jobs, set detail.jobs to some of %v", Names())
+		}
+	default:
+		return nil, false, nil
+	}
+
+	results, err := RunAll(ctx, names)
+	return results, true, err
+}
+
+// RunCLI handles `<binary> jobs` (show job status), `<binary> run [job...]`
+// and `<binary> <job>`, reporting false when args don't name a command
+func RunCLI(ctx context.Context, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch {
+	case args[0] == "jobs":
+		statuses, err := Statuses(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		byName := make(map[string]Status, len(statuses))
+		for _, status := range statuses {
+			byName[status.Name] = status
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		for _, name := range Names() {
+			status, ok := byName[name]
+			if !ok {
+				status = Status{Name: name}
+			}
+			encoder.Encode(status)
+		}
+	case args[0] == "run":
+		if _, err := RunAll(ctx, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case registry[args[0]].Run != nil:
+		if _, err := Run(ctx, args[0]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		return false
+	}
+	return true
+}
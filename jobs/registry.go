@@ -0,0 +1,17 @@
+package jobs
+
+import (
+	"connection/helpers"
+	"context"
+	"time"
+)
+
+func init() {
+	Register("purge-account-deletions", 10*time.Minute, helpers.PurgeDueAccountDeletions)
+	Register("expire-otps", 0, helpers.ExpireOTPs)
+	Register("purge-deleted-transactions", 10*time.Minute, helpers.PurgeDeletedTransactions)
+	Register("materialize-recurring", 10*time.Minute, func(ctx context.Context) (int, error) {
+		return helpers.MaterializeDueRecurring(ctx, time.Now())
+	})
+	Register("send-reminders", 30*time.Minute, helpers.SendDueReminders)
+}
@@ -54,8 +54,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"os"
+	"time"
 
+	"connection/jobs"
+	"connection/migrations"
 	"connection/routes"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -72,22 +77,53 @@ func init() {
     r := gin.Default()
     r.GET("/health", func(c *gin.Context) { c.JSON(200, gin.H{"msg": "running"}) })
 
-    log.Println(">> Registering auth/user/trip routes")
+    log.Println(">> Registering auth/user/trip/friend routes")
     routes.AuthRoutes(r)
+    routes.ReminderRoutes(r)
     routes.UserRoutes(r)
     routes.TripRoutes(r)
+    routes.FriendRoutes(r)
 
     r.NoRoute(func(c *gin.Context) {
         c.JSON(404, gin.H{"error": "Route not found"})
     })
 
     ginLambdaV2 = ginadapter.NewV2(r)
+
+    // Cold starts can bring the database up to date; a failure is logged and
+    // the function keeps serving, the migrate job can be run again later
+    if os.Getenv("MIGRATE_ON_START") == "true" {
+        ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+        defer cancel()
+        if _, err := jobs.Run(ctx, "migrate"); err != nil {
+            log.Printf(">> Migrations on start failed: %v", err)
+        }
+    }
 }
 
-func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+// handler serves HTTP requests from API Gateway and runs background jobs for
+// scheduled events, see jobs.HandleEvent
+func handler(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+    if results, handled, err := jobs.HandleEvent(ctx, raw); handled {
+        return results, err
+    }
+
+    var req events.APIGatewayV2HTTPRequest
+    if err := json.Unmarshal(raw, &req); err != nil {
+        return nil, err
+    }
     return ginLambdaV2.ProxyWithContext(ctx, req)
 }
 
 func main() {
+    // `go run . migrations` shows which data migrations were applied
+    if migrations.RunCLI(context.Background(), os.Args[1:]) {
+        return
+    }
+    // `go run . jobs`, `go run . run [job...]` or `go run . <job>` run jobs
+    // locally, `go run . migrate` applies migrations and creates indexes
+    if jobs.RunCLI(context.Background(), os.Args[1:]) {
+        return
+    }
     lambda.Start(handler)
 }
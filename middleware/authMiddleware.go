@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"connection/helpers"
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,6 +27,21 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens outlive a deleted account, so the account is checked too
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		deleted, checkErr := helpers.AccountDeleted(ctx, claims.Uid)
+		if checkErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": checkErr.Error()})
+			c.Abort()
+			return
+		}
+		if deleted {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "This account has been deleted"})
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
 		c.Set("email", claims.Email)
 		c.Set("first_name", claims.First_name)
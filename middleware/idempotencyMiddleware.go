@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"bytes"
+	"connection/helpers"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIdempotentBodyBytes bounds how much of a request body is read to fingerprint it
+const maxIdempotentBodyBytes = 32 << 20
+
+// responseRecorder keeps a copy of what the handler writes
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	if w.body.Len() <= helpers.MaxReplayedResponseBytes {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	if w.body.Len() <= helpers.MaxReplayedResponseBytes {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency honors the Idempotency-Key header: the first response to a key
+// is stored and replayed to retries of the same request, so a retried payment
+// isn't recorded twice. Requests without the header pass straight through.
+// Server errors and rate limits release the key so the request can be retried.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > helpers.MaxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentBodyBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Could not read request body: " + err.Error()})
+			return
+		}
+		if len(body) > maxIdempotentBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		scope := c.GetString("uid")
+		if scope == "" {
+			scope = helpers.AnonymousIdempotencyScope(body, c.ClientIP())
+		}
+		id := helpers.IdempotencyRecordID(scope, c.Request.Method, c.FullPath(), key)
+		record, err := helpers.ReserveIdempotencyKey(ctx, id, helpers.RequestHash(c.Request.URL.RawQuery, body))
+		switch err {
+		case nil:
+		case helpers.ErrIdempotencyKeyReused, helpers.ErrIdempotencyKeyInProgress:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error checking Idempotency-Key: " + err.Error()})
+			return
+		}
+		if record != nil {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.Status_Code, record.Content_Type, record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The handler's context may be gone by now
+		saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer saveCancel()
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests || recorder.body.Len() > helpers.MaxReplayedResponseBytes {
+			if err := helpers.ReleaseIdempotencyKey(saveCtx, id); err != nil {
+				log.Printf("Could not release Idempotency-Key %s: %v", key, err)
+			}
+			return
+		}
+		if err := helpers.CompleteIdempotencyKey(saveCtx, id, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Printf("Could not store response for Idempotency-Key %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"connection/helpers"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nonEmpty limits a unique index to documents where the field is a non-empty
+// string, so users without a phone or accounts whose email was removed on
+// deletion don't collide with each other
+func nonEmpty(field string) *options.IndexOptions {
+	return options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}})
+}
+
+// indexes are the indexes the queries of the app rely on
+var indexes = []Index{
+	// Signup and login look users up by email and phone; the unique indexes
+	// are what really keeps two accounts from sharing them
+	{"user", mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}, Options: nonEmpty("email").SetName("email_unique")}},
+	{"user", mongo.IndexModel{Keys: bson.D{{Key: "phone", Value: 1}}, Options: nonEmpty("phone").SetName("phone_unique")}},
+	{"user", mongo.IndexModel{Keys: bson.D{{Key: "phone_e164", Value: 1}}, Options: nonEmpty("phone_e164").SetName("phone_e164_unique")}},
+	{"user", mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true).SetName("user_id_unique")}},
+	{"user", mongo.IndexModel{Keys: bson.D{{Key: "deletion_scheduled_at", Value: 1}}, Options: options.Index().SetSparse(true)}},
+
+	{"trips", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}}, Options: options.Index().SetUnique(true).SetName("trip_id_unique")}},
+	{"trips", mongo.IndexModel{Keys: bson.D{{Key: "invite_code", Value: 1}}, Options: nonEmpty("invite_code").SetName("invite_code_unique")}},
+	{"trips", mongo.IndexModel{Keys: bson.D{{Key: "creator_id", Value: 1}}}},
+
+	// A member is claimed by one user and a user claims one member per trip,
+	// even when two claims race without a transaction
+	{"LinkedMembers", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "uid", Value: 1}}, Options: nonEmpty("uid").SetName(helpers.LinkedMemberUIDIndex)}},
+	{"LinkedMembers", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "member_id", Value: 1}}, Options: nonEmpty("member_id").SetName(helpers.LinkedMemberIDIndex)}},
+	{"LinkedMembers", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "name", Value: 1}}}},
+	{"LinkedMembers", mongo.IndexModel{Keys: bson.D{{Key: "uid", Value: 1}}}},
+
+	// Listings page through a trip's transactions newest first
+	{"transaction", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "created_at", Value: -1}}}},
+	{"transaction", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "import_key", Value: 1}}, Options: nonEmpty("import_key").SetName("trip_id_import_key_unique")}},
+	{"transaction", mongo.IndexModel{Keys: bson.D{{Key: "occurrence_key", Value: 1}}, Options: nonEmpty("occurrence_key").SetName("occurrence_key_unique")}},
+	{"transaction", mongo.IndexModel{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)}},
+
+	// Expired codes are removed by Mongo itself; the expire-otps job still
+	// clears used ones
+	{"otp", mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0).SetName("expires_at_ttl")}},
+	{"otp", mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}}},
+
+	// Stored responses of Idempotency-Key requests are replayed until they expire
+	{"idempotency_keys", mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}},
+
+	{"friendships", mongo.IndexModel{Keys: bson.D{{Key: "requester_id", Value: 1}, {Key: "addressee_id", Value: 1}}}},
+	{"friendships", mongo.IndexModel{Keys: bson.D{{Key: "addressee_id", Value: 1}, {Key: "status", Value: 1}}}},
+
+	{"trip_invitations", mongo.IndexModel{Keys: bson.D{{Key: "uid", Value: 1}, {Key: "status", Value: 1}}}},
+	{"trip_invitations", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "status", Value: 1}}}},
+
+	{"trip_events", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "created_at", Value: -1}}}},
+
+	{"recurring_expenses", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}}}},
+	{"recurring_expenses", mongo.IndexModel{Keys: bson.D{{Key: "next_run_at", Value: 1}}, Options: options.Index().SetSparse(true)}},
+
+	{"reminder_preferences", mongo.IndexModel{Keys: bson.D{{Key: "uid", Value: 1}, {Key: "trip_id", Value: 1}}, Options: options.Index().SetUnique(true)}},
+	{"nudges", mongo.IndexModel{Keys: bson.D{{Key: "trip_id", Value: 1}, {Key: "from_member_id", Value: 1}, {Key: "to_member_id", Value: 1}}, Options: options.Index().SetUnique(true)}},
+}
@@ -0,0 +1,186 @@
+// Package migrations keeps the database in the shape the code expects: it
+// creates the declared indexes and applies versioned data migrations, each
+// recorded once in the migrations collection.
+package migrations
+
+import (
+	"connection/database"
+	"connection/jobs"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Index is an index the code relies on
+type Index struct {
+	Collection string
+	Model      mongo.IndexModel
+}
+
+// Migration is a one-off change to existing data. Up reports how many
+// documents it touched and must be safe to run again after a failure.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context) (int, error)
+}
+
+// Record is an applied migration, one document per version
+type Record struct {
+	Version     int       `bson:"_id" json:"version"`
+	Name        string    `bson:"name" json:"name"`
+	Applied_At  time.Time `bson:"applied_at" json:"applied_at"`
+	Affected    int       `bson:"affected" json:"affected"`
+	Duration_Ms int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+var migrationCollection *mongo.Collection = database.OpenCollection(database.Client, "migrations")
+
+func init() {
+	// Under Lambda's 15 minute limit, so the lock of a killed run doesn't outlive it
+	jobs.Register("migrate", 14*time.Minute, Migrate)
+}
+
+// ordered returns the migrations sorted by version, failing on duplicates
+func ordered() ([]Migration, error) {
+	sorted := append([]Migration{}, registry...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("migration version %d is declared twice", sorted[i].Version)
+		}
+	}
+	return sorted, nil
+}
+
+// Applied returns the migrations already recorded, by version
+func Applied(ctx context.Context) (map[int]Record, error) {
+	cursor, err := migrationCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching applied migrations: %w", err)
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("error decoding applied migrations: %w", err)
+	}
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// ApplyPending runs the migrations that haven't been applied yet in version
+// order and stops at the first that fails, so later ones never run on data
+// an earlier one didn't finish
+func ApplyPending(ctx context.Context) (int, error) {
+	migrations, err := ordered()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := Applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	affected := 0
+	for _, migration := range migrations {
+		if _, done := applied[migration.Version]; done {
+			continue
+		}
+		started := time.Now()
+		count, err := migration.Up(ctx)
+		affected += count
+		if err != nil {
+			return affected, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err = migrationCollection.InsertOne(ctx, Record{
+			Version:     migration.Version,
+			Name:        migration.Name,
+			Applied_At:  time.Now(),
+			Affected:    count,
+			Duration_Ms: time.Since(started).Milliseconds(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return affected, fmt.Errorf("error recording migration %d: %w", migration.Version, err)
+		}
+		log.Printf(">> Migration %d (%s): %d documents in %s", migration.Version, migration.Name, count, time.Since(started))
+	}
+	return affected, nil
+}
+
+// EnsureIndexes creates every declared index. Creating an index that already
+// exists is a no-op; one that can't be built, e.g. a unique index over
+// duplicate data, doesn't keep the others from being created.
+func EnsureIndexes(ctx context.Context) (int, error) {
+	created := 0
+	var failures []string
+	for _, index := range indexes {
+		name, err := database.OpenCollection(database.Client, index.Collection).Indexes().CreateOne(ctx, index.Model)
+		if err != nil {
+			failures = append(failures, index.Collection+"."+name+": "+err.Error())
+			continue
+		}
+		created++
+	}
+	if len(failures) > 0 {
+		return created, errors.New("error creating indexes: " + strings.Join(failures, "; "))
+	}
+	return created, nil
+}
+
+// Migrate applies the pending data migrations and then makes sure every
+// index exists. Migrations go first so unique indexes are built on data
+// they already cleaned up.
+func Migrate(ctx context.Context) (int, error) {
+	affected, err := ApplyPending(ctx)
+	if err != nil {
+		return affected, err
+	}
+	created, err := EnsureIndexes(ctx)
+	return affected + created, err
+}
+
+// status is one line of `<binary> migrations`
+type status struct {
+	Version int     `json:"version"`
+	Name    string  `json:"name"`
+	Applied bool    `json:"applied"`
+	Record  *Record `json:"record,omitempty"`
+}
+
+// RunCLI handles `<binary> migrations`, which shows the migrations and
+// whether they were applied, reporting false for any other args.
+// `<binary> migrate` applies them through the jobs CLI.
+func RunCLI(ctx context.Context, args []string) bool {
+	if len(args) == 0 || args[0] != "migrations" {
+		return false
+	}
+	migrations, err := ordered()
+	if err != nil {
+		log.Fatal(err)
+	}
+	applied, err := Applied(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, migration := range migrations {
+		line := status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			line.Applied, line.Record = true, &record
+		}
+		encoder.Encode(line)
+	}
+	return true
+}
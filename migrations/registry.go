@@ -0,0 +1,13 @@
+package migrations
+
+import "connection/helpers"
+
+// registry lists the data migrations. Versions are never reused or
+// reordered once released; add new migrations at the end.
+var registry = []Migration{
+	{Version: 1, Name: "trip-member-ids", Up: helpers.MigrateAllTripMembers},
+	{Version: 2, Name: "user-phones-e164", Up: helpers.BackfillUserPhones},
+	{Version: 3, Name: "dedupe-member-links", Up: helpers.DedupeMemberLinks},
+	{Version: 4, Name: "rotate-legacy-invite-codes", Up: helpers.RotateLegacyInviteCodes},
+	{Version: 5, Name: "dedupe-user-phones", Up: helpers.DedupeUserPhones},
+}
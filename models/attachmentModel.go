@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Attachment is a file, usually a receipt, attached to a transaction.
+// The file itself lives in the blob store under Key.
+type Attachment struct {
+	Attachment_ID *string   `json:"attachment_id"`
+	Key           *string   `json:"-"`
+	Filename      *string   `json:"filename"`
+	Content_Type  *string   `json:"content_type"`
+	Size          int64     `json:"size"`
+	Uploaded_By   *string   `json:"uploaded_by"`
+	Uploaded_At   time.Time `json:"uploaded_at"`
+}
@@ -12,6 +12,11 @@ type ContactInfo struct {
 }
 type GetContact struct {
 	Contacts			[]Contact 				`json:"contacts"`
+	// Region used for numbers written without a country code, e.g. "IN"
+	Region				string 					`json:"region"`
+	// When set, every contactno is the hex SHA-256 of the E.164 number. This
+	// only obscures numbers, see helpers.HashPhone
+	Hashed				bool 					`json:"hashed"`
 }
 
 type PostContact struct {
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Friendship is a friend request between two users, a friendship once accepted
+type Friendship struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Requester_ID *string            `json:"requester_id"`
+	Addressee_ID *string            `json:"addressee_id"`
+	Status       *string            `json:"status"`
+	Created_At   time.Time          `json:"created_at"`
+	Responded_At *time.Time         `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
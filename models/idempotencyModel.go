@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the response to a request made with an
+// Idempotency-Key, kept so a retry gets the same answer
+type IdempotencyRecord struct {
+	ID           string    `bson:"_id"`
+	Request_Hash string    `bson:"request_hash"`
+	Completed    bool      `bson:"completed"`
+	Status_Code  int       `bson:"status_code,omitempty"`
+	Content_Type string    `bson:"content_type,omitempty"`
+	Body         []byte    `bson:"body,omitempty"`
+	Created_At   time.Time `bson:"created_at"`
+	Expires_At   time.Time `bson:"expires_at"`
+}
@@ -7,5 +7,6 @@ type Member struct {
 	ID 				primitive.ObjectID		`bson:"_id"`
 	Trip_ID			*string					`json:"trip_id"`
 	Name			*string					`json:"name"`
+	Member_ID		*string					`bson:"member_id,omitempty" json:"member_id"`
 	Uid				*string					`json:"uid"`
 }
\ No newline at end of file
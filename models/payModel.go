@@ -11,9 +11,19 @@ type Transaction struct{
 	Trip_ID			*string					`json:"trip_id"`
 	PayerName		*string					`json:"payer_name"`
 	ReciverName		*string					`json:"reciever_name"`
+	Payer_ID		*string					`bson:"payer_id,omitempty" json:"payer_id"`
+	Reciver_ID		*string					`bson:"reciver_id,omitempty" json:"reciever_id"`
 	Amount			*string					`json:"amount"`
 	Description		*string					`json:"description"`
+	Category		*string					`bson:"category,omitempty" json:"category,omitempty"`
+	Import_Key		*string					`bson:"import_key,omitempty" json:"-"`
+	Attachments		*[]Attachment			`bson:"attachments,omitempty" json:"attachments,omitempty"`
+	Deleted_At		*time.Time				`bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Recurring_ID	*string					`bson:"recurring_id,omitempty" json:"recurring_id,omitempty"`
+	Occurrence_At	*time.Time				`bson:"occurrence_at,omitempty" json:"occurrence_at,omitempty"`
+	Occurrence_Key	*string					`bson:"occurrence_key,omitempty" json:"-"`
 	IsDeleted   	*bool              `bson:"is_deleted" json:"is_deleted"`
 	Type			*string					`json:"type"`
 	Created_At		time.Time				`json:"created_at"`
+	Version			int64					`bson:"version" json:"version"`
 }   
\ No newline at end of file
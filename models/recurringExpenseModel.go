@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecurringExpense is a template for an expense that repeats on a schedule,
+// such as rent or utilities. Every occurrence becomes one transaction per
+// participant other than the member who pays.
+type RecurringExpense struct {
+	ID           primitive.ObjectID   `bson:"_id"`
+	Trip_ID      *string              `json:"trip_id"`
+	Created_By   *string              `json:"created_by"`
+	Description  *string              `json:"description"`
+	Category     *string              `bson:"category,omitempty" json:"category,omitempty"`
+	Amount       *string              `json:"amount"`
+	Paid_By      *string              `json:"paid_by"`
+	Participants []string             `json:"participants"`
+	Split_Rule   *string              `json:"split_rule"` // equal, exact, percent or shares
+	Split_Values map[string]float64   `bson:"split_values,omitempty" json:"split_values,omitempty"`
+	Frequency    *string              `json:"frequency"` // daily, weekly, monthly or cron
+	Interval     int                  `json:"interval"`
+	Cron         *string              `bson:"cron,omitempty" json:"cron,omitempty"`
+	Start_At     time.Time            `json:"start_at"`
+	End_At       *time.Time           `bson:"end_at,omitempty" json:"end_at,omitempty"`
+	Next_Run_At  *time.Time           `bson:"next_run_at,omitempty" json:"next_run_at,omitempty"`
+	Paused       bool                 `json:"paused"`
+	IsDeleted    bool                 `bson:"is_deleted" json:"is_deleted"`
+	Exceptions   []RecurringException `bson:"exceptions,omitempty" json:"exceptions,omitempty"`
+	// Why the occurrence at Next_Run_At couldn't be saved, e.g. the payer left
+	// the trip. The template waits there until the occurrence is skipped or
+	// the trip is fixed.
+	Last_Error    *string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	Last_Error_At *time.Time `bson:"last_error_at,omitempty" json:"last_error_at,omitempty"`
+	Created_At    time.Time  `json:"created_at"`
+}
+
+// RecurringException skips or changes a single occurrence before it is materialized
+type RecurringException struct {
+	Occurrence_At time.Time `json:"occurrence_at"`
+	Skip          bool      `json:"skip"`
+	Amount        *string   `bson:"amount,omitempty" json:"amount,omitempty"`
+	Description   *string   `bson:"description,omitempty" json:"description,omitempty"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReminderSettings controls the settle-up emails sent to the debtors of a trip
+type ReminderSettings struct {
+	Mode           *string    `json:"mode"`
+	Days_After_End *int       `bson:"days_after_end,omitempty" json:"days_after_end,omitempty"`
+	Last_Sent_At   *time.Time `bson:"last_sent_at,omitempty" json:"last_sent_at,omitempty"`
+}
+
+// ReminderPreference is a user snoozing or unsubscribing from the reminders of
+// one trip, or of every trip when Trip_ID is empty
+type ReminderPreference struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Uid           *string            `json:"uid"`
+	Trip_ID       *string            `json:"trip_id"`
+	Snoozed_Until *time.Time         `bson:"snoozed_until,omitempty" json:"snoozed_until,omitempty"`
+	Unsubscribed  *bool              `bson:"unsubscribed,omitempty" json:"unsubscribed,omitempty"`
+	Updated_At    time.Time          `json:"updated_at"`
+}
+
+// Nudge is the last reminder a creditor sent a debtor by hand
+type Nudge struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Trip_ID        *string            `json:"trip_id"`
+	From_Member_ID *string            `json:"from_member_id"`
+	To_Member_ID   *string            `json:"to_member_id"`
+	Sent_At        time.Time          `json:"sent_at"`
+}
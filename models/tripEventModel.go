@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TripEvent is an entry in a trip's audit trail
+type TripEvent struct {
+	ID         primitive.ObjectID     `bson:"_id"`
+	Trip_ID    *string                `json:"trip_id"`
+	Type       *string                `json:"type"`
+	Actor_ID   *string                `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	Member_ID  *string                `bson:"member_id,omitempty" json:"member_id,omitempty"`
+	Details    map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	Created_At time.Time              `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TripInvitation is either an admin inviting a user into a trip (INVITE) or a
+// user asking to join a trip that requires approval (JOIN_REQUEST)
+type TripInvitation struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Trip_ID      *string            `json:"trip_id"`
+	Kind         *string            `json:"kind"`
+	Uid          *string            `json:"uid"`
+	Member_ID    *string            `bson:"member_id,omitempty" json:"member_id,omitempty"`
+	Created_By   *string            `json:"created_by"`
+	Status       *string            `json:"status"`
+	Created_At   time.Time          `json:"created_at"`
+	Responded_At *time.Time         `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
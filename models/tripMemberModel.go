@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TripMember is one participant of a trip.
+// Member_ID is the stable key transactions and member links point at, so the
+// display name can change and two members can share a name.
+type TripMember struct {
+	Member_ID    *string   `json:"member_id"`
+	Display_Name *string   `json:"display_name"`
+	Uid          *string   `bson:"uid,omitempty" json:"uid,omitempty"`
+	Joined_At    time.Time `json:"joined_at"`
+}
@@ -7,13 +7,46 @@ import (
 )
 
 type Trip struct {
-	ID          primitive.ObjectID `bson:"_id"`
-	Trip_ID     *string            `json:"trip_id"`
-	Name        *string            `json:"trip_name"`
-	Description *string            `json:"description"`
-	Members     *[]string          `json:"members"`
-	IsDeleted   *bool              `bson:"is_deleted" json:"is_deleted"`
-	Creator_ID  *string            `json:"creator_id"`
-	Invite_Code *string            `json:"invite_code"`
-	Created_At  time.Time          `json:"created_at"`
+	ID                primitive.ObjectID `bson:"_id"`
+	Trip_ID           *string            `json:"trip_id"`
+	Name              *string            `json:"trip_name"`
+	Description       *string            `json:"description"`
+	Members           *[]string          `json:"members"`
+	Member_List       *[]TripMember      `bson:"member_list" json:"member_list"`
+	IsDeleted         *bool              `bson:"is_deleted" json:"is_deleted"`
+	Creator_ID        *string            `json:"creator_id"`
+	Invite_Code       *string            `json:"invite_code"`
+	Invite_Expires_At *time.Time         `bson:"invite_expires_at,omitempty" json:"invite_expires_at,omitempty"`
+	Invite_Max_Uses   *int               `bson:"invite_max_uses,omitempty" json:"invite_max_uses,omitempty"`
+	Invite_Uses       *int               `bson:"invite_uses,omitempty" json:"invite_uses,omitempty"`
+	Invite_Revoked    *bool              `bson:"invite_revoked,omitempty" json:"invite_revoked,omitempty"`
+	Approval_Required *bool              `bson:"approval_required,omitempty" json:"approval_required,omitempty"`
+	Currency          *string            `bson:"currency,omitempty" json:"currency,omitempty"`
+	Categories        *[]string          `bson:"categories,omitempty" json:"categories,omitempty"`
+	Total_Budget      *float64           `bson:"total_budget,omitempty" json:"total_budget,omitempty"`
+	Category_Budgets  map[string]float64 `bson:"category_budgets,omitempty" json:"category_budgets,omitempty"`
+	Start_Date        *time.Time         `bson:"start_date,omitempty" json:"start_date,omitempty"`
+	End_Date          *time.Time         `bson:"end_date,omitempty" json:"end_date,omitempty"`
+	Destination       *string            `bson:"destination,omitempty" json:"destination,omitempty"`
+	Timezone          *string            `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Cover_Image       *Attachment        `bson:"cover_image,omitempty" json:"cover_image,omitempty"`
+	Reminders         *ReminderSettings  `bson:"reminders,omitempty" json:"reminders,omitempty"`
+	Status            *string            `bson:"status,omitempty" json:"status,omitempty"`
+	Status_Changed_At *time.Time         `bson:"status_changed_at,omitempty" json:"status_changed_at,omitempty"`
+	Closed_At         *time.Time         `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	Final_Balances    *[]FinalBalance    `bson:"final_balances,omitempty" json:"final_balances,omitempty"`
+	Created_At        time.Time          `json:"created_at"`
+	// Incremented on every write, see helpers.BumpVersion
+	Version int64 `bson:"version" json:"version"`
+	// Friends to invite when the trip is created, never stored on the trip
+	Friend_UIDs *[]string `bson:"-" json:"friend_uids,omitempty"`
+	// Whether the trip is upcoming, ongoing or past, worked out when listing trips
+	Phase string `bson:"-" json:"phase,omitempty"`
+}
+
+// FinalBalance is a member's balance frozen when the trip was closed
+type FinalBalance struct {
+	Member_ID    *string `json:"member_id"`
+	Display_Name *string `json:"display_name"`
+	Balance      float64 `json:"balance"`
 }
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SecretUserFields are the keys no user view in a response may carry
+var SecretUserFields = []string{"password", "token", "refresh_token", "phone_hash", "otp"}
+
+// StoredUserSecrets are the secret values UserWithSecrets carries
+var StoredUserSecrets = []string{"secret-password-hash", "secret-phone-hash", "secret-stored-token", "secret-stored-refresh-token"}
+
+// UserWithSecrets is a user whose secrets are easy to spot in a response,
+// for tests checking they never leak
+func UserWithSecrets(uid string) User {
+	text := func(s string) *string { return &s }
+	deleted := false
+	return User{
+		ID:            primitive.NewObjectID(),
+		First_Name:    text("Ada"),
+		Last_Name:     text("Lovelace"),
+		Password:      text("secret-password-hash"),
+		Email:         text(uid + "@example.com"),
+		Phone:         text("+14155550100"),
+		Phone_E164:    text("+14155550100"),
+		Phone_Hash:    text("secret-phone-hash"),
+		Token:         text("secret-stored-token"),
+		User_type:     text("USER"),
+		Refresh_token: text("secret-stored-refresh-token"),
+		Created_at:    time.Now(),
+		User_id:       text(uid),
+		IsDeleted:     &deleted,
+	}
+}
+
+// FindUserSecrets lists where a JSON body carries a secret key or one of the
+// stored secret values. Keys named in allowedTopLevel may appear at the top
+// level, a login hands out the tokens it just issued there.
+func FindUserSecrets(body []byte, allowedTopLevel ...string) ([]string, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, err
+	}
+	var found []string
+	var walk func(path string, depth int, v interface{})
+	walk = func(path string, depth int, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				allowed := false
+				for _, name := range allowedTopLevel {
+					allowed = allowed || (depth == 0 && key == name)
+				}
+				for _, secret := range SecretUserFields {
+					if key == secret && !allowed {
+						found = append(found, path+"."+key)
+					}
+				}
+				walk(path+"."+key, depth+1, value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				walk(path+"[]", depth+1, value)
+			}
+		}
+	}
+	walk("$", 0, decoded)
+	for _, value := range StoredUserSecrets {
+		if strings.Contains(string(body), value) {
+			found = append(found, "value "+value)
+		}
+	}
+	return found, nil
+}
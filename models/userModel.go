@@ -6,15 +6,77 @@ import (
 )
 
 type User struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	First_Name    *string            `json:"first_name"`
-	Last_Name     *string            `json:"last_name"`
-	Password      *string            `json:"password"`
-	Email         *string            `json:"email" validate:"email,required"`
-	Phone         *string            `json:"phone" validate:"required"`
-	Token         *string            `json:"token"`
-	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Refresh_token *string            `json:"refresh_token"`
-	Created_at    time.Time          `json:"created_at"`
-	User_id       *string            `json:"user_id"`
+	ID                    primitive.ObjectID `bson:"_id"`
+	First_Name            *string            `json:"first_name"`
+	Last_Name             *string            `json:"last_name"`
+	Password              *string            `json:"password"`
+	Email                 *string            `json:"email" validate:"email,required"`
+	Phone                 *string            `json:"phone" validate:"required"`
+	Phone_E164            *string            `bson:"phone_e164,omitempty" json:"-"`
+	Phone_Hash            *string            `bson:"phone_hash,omitempty" json:"-"`
+	Token                 *string            `json:"token"`
+	User_type             *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
+	Refresh_token         *string            `json:"refresh_token"`
+	Created_at            time.Time          `json:"created_at"`
+	User_id               *string            `json:"user_id"`
+	Deletion_Requested_At *time.Time         `bson:"deletion_requested_at,omitempty" json:"deletion_requested_at,omitempty"`
+	Deletion_Scheduled_At *time.Time         `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	IsDeleted             *bool              `bson:"is_deleted,omitempty" json:"is_deleted,omitempty"`
+}
+
+// PublicUser is what other users are allowed to see about a user
+type PublicUser struct {
+	User_id    *string `json:"user_id"`
+	First_Name *string `json:"first_name"`
+	Last_Name  *string `json:"last_name"`
+}
+
+// SelfUser is the profile returned to the user it belongs to
+type SelfUser struct {
+	User_id               *string    `json:"user_id"`
+	First_Name            *string    `json:"first_name"`
+	Last_Name             *string    `json:"last_name"`
+	Email                 *string    `json:"email"`
+	Phone                 *string    `json:"phone"`
+	User_type             *string    `json:"user_type"`
+	Created_at            time.Time  `json:"created_at"`
+	Deletion_Scheduled_At *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// AdminUser is the view of a user handed to admins
+type AdminUser struct {
+	SelfUser
+	Deletion_Requested_At *time.Time `json:"deletion_requested_at,omitempty"`
+	IsDeleted             *bool      `json:"is_deleted,omitempty"`
+}
+
+// Password, Token and Refresh_token never leave the server, whichever view is used
+
+func (u User) Public() PublicUser {
+	return PublicUser{
+		User_id:    u.User_id,
+		First_Name: u.First_Name,
+		Last_Name:  u.Last_Name,
+	}
+}
+
+func (u User) Self() SelfUser {
+	return SelfUser{
+		User_id:               u.User_id,
+		First_Name:            u.First_Name,
+		Last_Name:             u.Last_Name,
+		Email:                 u.Email,
+		Phone:                 u.Phone,
+		User_type:             u.User_type,
+		Created_at:            u.Created_at,
+		Deletion_Scheduled_At: u.Deletion_Scheduled_At,
+	}
+}
+
+func (u User) Admin() AdminUser {
+	return AdminUser{
+		SelfUser:              u.Self(),
+		Deletion_Requested_At: u.Deletion_Requested_At,
+		IsDeleted:             u.IsDeleted,
+	}
 }
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserViewsCarryNoSecrets(t *testing.T) {
+	user := UserWithSecrets("user-1")
+	views := map[string]interface{}{
+		"public": user.Public(),
+		"self":   user.Self(),
+		"admin":  user.Admin(),
+	}
+	for name, view := range views {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(view)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found, err := FindUserSecrets(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, where := range found {
+				t.Errorf("secret at %s", where)
+			}
+		})
+	}
+}
+
+func TestPublicViewHidesContactDetails(t *testing.T) {
+	user := UserWithSecrets("user-1")
+	body, err := json.Marshal(user.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{*user.Email, *user.Phone} {
+		if strings.Contains(string(body), value) {
+			t.Errorf("public view contains %q", value)
+		}
+	}
+}
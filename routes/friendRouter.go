@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"connection/controllers"
+	"connection/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FriendRoutes(incomingRoutes *gin.Engine) {
+	authorized := incomingRoutes.Group("", middleware.Authenticate())
+
+	authorized.GET("/friends", controllers.GetFriends())
+	authorized.POST("/friends/suggestions", controllers.GetFriendSuggestions())
+	authorized.POST("/friends/request", middleware.Idempotency(), controllers.SendFriendRequest())
+	authorized.GET("/friends/requests", controllers.GetFriendRequests())
+	authorized.POST("/friends/respond", middleware.Idempotency(), controllers.RespondToFriendRequest())
+	authorized.POST("/friends/remove", controllers.RemoveFriend())
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"connection/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReminderRoutes are the links in reminder emails. They carry a signed token
+// instead of a login, so they stay out of the authenticated groups. Opening a
+// link only asks for confirmation, the change is made by the POST of that page.
+func ReminderRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reminders/snooze", controllers.ConfirmSnoozeReminders())
+	incomingRoutes.POST("/reminders/snooze", controllers.SnoozeReminders())
+	incomingRoutes.GET("/reminders/unsubscribe", controllers.ConfirmUnsubscribeReminders())
+	incomingRoutes.POST("/reminders/unsubscribe", controllers.UnsubscribeReminders())
+}
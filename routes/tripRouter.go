@@ -8,20 +8,59 @@ import (
 )
 
 func TripRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.Use(middleware.Authenticate())
+	authorized := incomingRoutes.Group("", middleware.Authenticate())
 
-	incomingRoutes.POST("/trip/create", controllers.CreateTrip())
-	incomingRoutes.GET("/trip/getalltrip", controllers.GetAllTrip())
-	incomingRoutes.GET("/trip/getallmytrip", controllers.GetAllMyTrip())
-	incomingRoutes.POST("/trip/getmembers", controllers.GetAllNotFreeMemberOnInviteCode())
-	incomingRoutes.POST("/trip/linkmember", controllers.LinkMember())
-	incomingRoutes.POST("/trip/automaticlinkmember", controllers.AutomaticLinkMember())
-	incomingRoutes.POST("/trip/pay", controllers.Pay())
-	incomingRoutes.POST("/trip/settle", controllers.Settle())
-	incomingRoutes.POST("/trip/getAllTransaction", controllers.GetAllTransaction())
-	incomingRoutes.POST("/trip/getsettlements", controllers.GetSettlements())
-	incomingRoutes.POST("/trip/getcausualnamebyuid", controllers.GetCasualNameByUID())
-	incomingRoutes.POST("/trip/contactinfo", controllers.GetContactInfo())
-	incomingRoutes.POST("/trip/deleteTrip", controllers.DeleteTrip())
-	incomingRoutes.POST("/trip/deleteTransaction", controllers.DeleteTransaction())
+	authorized.POST("/trip/create", middleware.Idempotency(), controllers.CreateTrip())
+	authorized.GET("/trip/getalltrip", controllers.GetAllTrip())
+	authorized.GET("/trip/getallmytrip", controllers.GetAllMyTrip())
+	authorized.POST("/trip/getmembers", controllers.GetAllNotFreeMemberOnInviteCode())
+	authorized.POST("/trip/linkmember", middleware.Idempotency(), controllers.LinkMember())
+	authorized.POST("/trip/automaticlinkmember", middleware.Idempotency(), controllers.AutomaticLinkMember())
+	authorized.POST("/trip/pay", middleware.Idempotency(), controllers.Pay())
+	authorized.POST("/trip/settle", middleware.Idempotency(), controllers.Settle())
+	authorized.POST("/trip/getAllTransaction", controllers.GetAllTransaction())
+	authorized.POST("/trip/getsettlements", controllers.GetSettlements())
+	authorized.POST("/trip/getcausualnamebyuid", controllers.GetCasualNameByUID())
+	authorized.POST("/trip/contactinfo", controllers.GetContactInfo())
+	authorized.POST("/trip/deleteTrip", controllers.DeleteTrip())
+	authorized.POST("/trip/deleteTransaction", controllers.DeleteTransaction())
+	authorized.GET("/trip/transaction", controllers.GetTransaction())
+	authorized.POST("/trip/addmember", middleware.Idempotency(), controllers.AddTripMember())
+	authorized.POST("/trip/renamemember", controllers.RenameTripMember())
+	authorized.POST("/trip/removemember", controllers.RemoveTripMember())
+	authorized.POST("/trip/unlinkmember", controllers.UnlinkMember())
+	authorized.POST("/trip/transferclaim", controllers.TransferMemberClaim())
+	authorized.POST("/trip/events", controllers.GetTripEvents())
+	authorized.POST("/trip/rotateinvite", controllers.RotateInviteCode())
+	authorized.POST("/trip/revokeinvite", controllers.RevokeInviteCode())
+	authorized.POST("/trip/invite", middleware.Idempotency(), controllers.InviteUser())
+	authorized.GET("/trip/invitations", controllers.GetMyInvitations())
+	authorized.POST("/trip/respondinvite", middleware.Idempotency(), controllers.RespondToInvitation())
+	authorized.POST("/trip/setapproval", controllers.SetApprovalRequired())
+	authorized.POST("/trip/joinrequests", controllers.GetJoinRequests())
+	authorized.POST("/trip/respondjoinrequest", middleware.Idempotency(), controllers.RespondToJoinRequest())
+	authorized.POST("/trip/categories", controllers.GetTripCategories())
+	authorized.POST("/trip/addcategory", middleware.Idempotency(), controllers.AddTripCategory())
+	authorized.POST("/trip/setbudget", controllers.SetTripBudget())
+	authorized.POST("/trip/budgetreport", controllers.GetBudgetReport())
+	authorized.POST("/trip/report", controllers.GetTripReport())
+	authorized.POST("/trip/myreport", controllers.GetMyTripReport())
+	authorized.POST("/trip/export", controllers.ExportTrip())
+	authorized.POST("/trip/import", middleware.Idempotency(), controllers.ImportTransactions())
+	authorized.POST("/trip/attachment/upload", middleware.Idempotency(), controllers.UploadAttachment())
+	authorized.GET("/trip/attachment", controllers.DownloadAttachment())
+	authorized.POST("/trip/attachment/delete", controllers.DeleteAttachment())
+	authorized.POST("/trip/recurring/create", middleware.Idempotency(), controllers.CreateRecurringExpense())
+	authorized.POST("/trip/recurring/list", controllers.GetRecurringExpenses())
+	authorized.POST("/trip/recurring/pause", controllers.PauseRecurringExpense())
+	authorized.POST("/trip/recurring/delete", controllers.DeleteRecurringExpense())
+	authorized.POST("/trip/recurring/occurrence", controllers.UpdateRecurringOccurrence())
+	authorized.POST("/trip/reminders", controllers.SetTripReminders())
+	authorized.POST("/trip/nudge", controllers.NudgeMember())
+	authorized.POST("/trip/status", controllers.SetTripStatus())
+	authorized.GET("/trip", controllers.GetTrip())
+	authorized.POST("/trip/update", controllers.UpdateTrip())
+	authorized.POST("/trip/cover/upload", middleware.Idempotency(), controllers.UploadTripCover())
+	authorized.GET("/trip/cover", controllers.GetTripCover())
+	authorized.POST("/trip/cover/delete", controllers.DeleteTripCover())
 }
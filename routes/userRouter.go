@@ -8,8 +8,13 @@ import (
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.Use(middleware.Authenticate())
+	// A group of its own, so the routers don't stack Authenticate on each other
+	authorized := incomingRoutes.Group("", middleware.Authenticate())
 
-	incomingRoutes.GET("/users", controllers.GetUsers())
-	incomingRoutes.GET("/users/:user_id", controllers.GetUser())
+	authorized.GET("/users", controllers.GetUsers())
+	authorized.GET("/users/:user_id", controllers.GetUser())
+	authorized.GET("/users/me/export", controllers.ExportMyData())
+	authorized.POST("/users/me/delete", controllers.RequestAccountDeletion())
+	authorized.POST("/users/me/canceldelete", controllers.CancelAccountDeletion())
+	authorized.GET("/users/me/balances", controllers.GetMyBalanceSummary())
 }